@@ -0,0 +1,274 @@
+package patchstructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// coerce converts v into a value that can be set into a location of
+// type t.
+//
+// Values are converted the way they'd be decoded from JSON: numbers convert
+// to any numeric type, slices convert element-wise to slices and arrays,
+// maps convert to maps and to structs (with keys matched to the same field
+// names used in paths), and pointers are allocated as needed. This lets
+// an operation decoded from JSON, whose values are float64, []interface{},
+// and map[string]interface{}, set values into strongly typed structures.
+// A json.Number converts to any numeric type without first losing
+// precision as a float64, and numbers convert to json.Number.
+//
+// If strict is true then conversions that lose information are an error.
+// This includes numbers that can't be represented exactly by the target
+// type, such as 1.5 to an int or 300 to an int8, and map keys that don't
+// match a struct field.
+func coerce(v interface{}, t reflect.Type, strict bool) (reflect.Value, error) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Chan, reflect.Func, reflect.Interface,
+			reflect.Map, reflect.Ptr, reflect.Slice:
+			return reflect.Zero(t), nil
+		}
+
+		return reflect.Value{}, fmt.Errorf(
+			"%w: cannot use nil as type %s", ErrTypeMismatch, t)
+	}
+
+	return coerceValue(reflect.ValueOf(v), t, strict)
+}
+
+func coerceValue(val reflect.Value, t reflect.Type, strict bool) (reflect.Value, error) {
+	for val.Kind() == reflect.Interface && !val.IsNil() {
+		val = val.Elem()
+	}
+
+	// A null within a container is the zero value, like encoding/json
+	// decoding a null element or member. A null value itself is checked
+	// by coerce.
+	if !val.IsValid() || val.Kind() == reflect.Interface {
+		return reflect.Zero(t), nil
+	}
+
+	if val.Type().AssignableTo(t) {
+		return val, nil
+	}
+
+	switch {
+	case t.Kind() == reflect.Ptr:
+		if val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				return reflect.Zero(t), nil
+			}
+
+			val = val.Elem()
+		}
+
+		elem, err := coerceValue(val, t.Elem(), strict)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		result := reflect.New(t.Elem())
+		result.Elem().Set(elem)
+		return result, nil
+
+	case isNumber(val.Kind()) && isNumber(t.Kind()):
+		return coerceNumber(val, t, strict)
+
+	case val.Type() == jsonNumberType:
+		// A json.Number is converted exactly to any numeric type, but it
+		// is still a number so it can't be used as a string.
+		n, ok := jsonNumber(val)
+		if ok && isNumber(t.Kind()) {
+			return coerceNumber(n, t, strict)
+		}
+
+		return reflect.Value{}, fmt.Errorf(
+			"%w: cannot use number %s as type %s", ErrTypeMismatch, val, t)
+
+	case isNumber(val.Kind()) && t == jsonNumberType:
+		return coerceJSONNumber(val)
+
+	case val.Kind() == reflect.Slice || val.Kind() == reflect.Array:
+		switch t.Kind() {
+		case reflect.Slice:
+			if val.Kind() == reflect.Slice && val.IsNil() {
+				return reflect.Zero(t), nil
+			}
+
+			result := reflect.MakeSlice(t, val.Len(), val.Len())
+			return result, coerceElems(val, result, strict)
+
+		case reflect.Array:
+			if val.Len() != t.Len() {
+				return reflect.Value{}, fmt.Errorf(
+					"%w: cannot use %d elements as type %s",
+					ErrTypeMismatch, val.Len(), t)
+			}
+
+			result := reflect.New(t).Elem()
+			return result, coerceElems(val, result, strict)
+		}
+
+	case val.Kind() == reflect.Map:
+		switch t.Kind() {
+		case reflect.Map:
+			if val.IsNil() {
+				return reflect.Zero(t), nil
+			}
+
+			return coerceMap(val, t, strict)
+
+		case reflect.Struct:
+			return coerceStruct(val, t, strict)
+		}
+	}
+
+	// We only allow conversions between the same kinds. Go allows other
+	// conversions such as int to string but these are rarely what is meant.
+	if val.Kind() == t.Kind() && val.Type().ConvertibleTo(t) {
+		return val.Convert(t), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf(
+		"%w: cannot use %s as type %s", ErrTypeMismatch, val.Type(), t)
+}
+
+// coerceNumber converts the number val to the numeric type t.
+func coerceNumber(val reflect.Value, t reflect.Type, strict bool) (reflect.Value, error) {
+	result := val.Convert(t)
+	if !strict {
+		return result, nil
+	}
+
+	// Conversions between floats only lose precision, which is expected
+	// with floats, so they're only lossy if they overflow.
+	lossy := !testEqualNumber(val, result)
+	if testIsFloat(val.Kind()) && testIsFloat(t.Kind()) {
+		lossy = math.IsInf(result.Float(), 0) && !math.IsInf(val.Float(), 0)
+	}
+	if lossy {
+		return reflect.Value{}, fmt.Errorf(
+			"%w: lossy conversion of %v to type %s",
+			ErrTypeMismatch, val.Interface(), t)
+	}
+
+	return result, nil
+}
+
+// coerceJSONNumber converts the number val to a json.Number.
+func coerceJSONNumber(val reflect.Value) (reflect.Value, error) {
+	var n json.Number
+	switch {
+	case testIsInt(val.Kind()):
+		n = json.Number(strconv.FormatInt(val.Int(), 10))
+
+	case testIsUint(val.Kind()):
+		n = json.Number(strconv.FormatUint(val.Uint(), 10))
+
+	default:
+		f := val.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return reflect.Value{}, fmt.Errorf(
+				"%w: cannot use %v as type %s", ErrTypeMismatch, f, jsonNumberType)
+		}
+
+		n = json.Number(strconv.FormatFloat(f, 'g', -1, val.Type().Bits()))
+	}
+
+	return reflect.ValueOf(n), nil
+}
+
+// coerceElems coerces each element of from and sets it in the slice or
+// array to, which must have the same length.
+func coerceElems(from, to reflect.Value, strict bool) error {
+	for i := 0; i < from.Len(); i++ {
+		elem, err := coerceValue(from.Index(i), to.Type().Elem(), strict)
+		if err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+
+		to.Index(i).Set(elem)
+	}
+
+	return nil
+}
+
+// coerceMap coerces the map val to a map of type t.
+func coerceMap(val reflect.Value, t reflect.Type, strict bool) (reflect.Value, error) {
+	result := reflect.MakeMap(t)
+	for _, k := range val.MapKeys() {
+		// Keys are converted the same way as keys in paths when they're
+		// strings, such as from JSON objects.
+		var key reflect.Value
+		var err error
+		if k.Kind() == reflect.String && t.Key().Kind() != reflect.String {
+			key, err = mapKey(k.String(), t.Key())
+		} else {
+			key, err = coerceValue(k, t.Key(), strict)
+		}
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("key %v: %w", k.Interface(), err)
+		}
+
+		elem, err := coerceValue(val.MapIndex(k), t.Elem(), strict)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("key %v: %w", k.Interface(), err)
+		}
+
+		result.SetMapIndex(key, elem)
+	}
+
+	return result, nil
+}
+
+// coerceStruct coerces the map val to a struct of type t. Keys are matched
+// to the field names used in paths, falling back to a case-insensitive
+// match like encoding/json.
+func coerceStruct(val reflect.Value, t reflect.Type, strict bool) (reflect.Value, error) {
+	result := reflect.New(t).Elem()
+	for _, k := range val.MapKeys() {
+		name := fmt.Sprint(k.Interface())
+
+		var field reflect.Value
+		for i := 0; i < t.NumField(); i++ {
+			n, ok := structFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+
+			if n == name {
+				field = result.Field(i)
+				break
+			}
+			if !field.IsValid() && strings.EqualFold(n, name) {
+				field = result.Field(i)
+			}
+		}
+		if !field.IsValid() {
+			if strict {
+				return reflect.Value{}, fmt.Errorf(
+					"%w: unknown field %q for type %s", ErrTypeMismatch, name, t)
+			}
+
+			continue
+		}
+
+		elem, err := coerceValue(val.MapIndex(k), field.Type(), strict)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("field %q: %w", name, err)
+		}
+
+		field.Set(elem)
+	}
+
+	return result, nil
+}
+
+// isNumber returns true if the kind is an integer or float.
+func isNumber(k reflect.Kind) bool {
+	return testIsInt(k) || testIsUint(k) || testIsFloat(k)
+}
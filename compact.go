@@ -0,0 +1,242 @@
+package patchstructure
+
+// Compact returns a patch with the same effect as ops but with fewer
+// operations. The operations in ops are not modified.
+//
+// The following operations are simplified:
+//
+//   - A replace or remove of a path drops any earlier replace or inc of the
+//     same path, and any earlier add, replace, remove, inc, or copy of a
+//     path within it, since their result is overwritten. An earlier add or
+//     copy of the same path is combined with a replace into an add of the
+//     new value.
+//
+//   - An add or copy followed by a remove of the same path cancels out if
+//     the add created the value: it inserts a slice element, or the value
+//     was removed or moved away earlier in the patch. Otherwise the add may
+//     have replaced an existing member of an object, so both are kept.
+//
+//   - A move where From is the same as Path is dropped.
+//
+// Operations are only simplified when no operation in between reads or
+// changes the same path, or shifts it by adding or removing a slice
+// element. Compact doesn't have the value so, as with Transform, path
+// elements that are integers are treated as slice indices.
+//
+// Compact assumes that the patch applies without error: operations that
+// would fail, such as replacing a path that doesn't exist before it is
+// removed, may be dropped. Operations with Glob set are never simplified
+// and nothing is simplified across them.
+func Compact(ops []*Operation) []*Operation {
+	c := &compacter{ops: make([]*Operation, 0, len(ops))}
+	for _, op := range ops {
+		// Operations with invalid paths are kept as is so that they still
+		// fail, but they're never simplified. Glob operations are kept the
+		// same way since the paths they change aren't known.
+		path, err := parsePointer(op.Path)
+		if err != nil || op.Glob {
+			c.append(op, nil, nil)
+			continue
+		}
+
+		// A nil path marks an invalid path so the root is made non-nil
+		parts := path.Parts
+		if parts == nil {
+			parts = []string{}
+		}
+
+		var from []string
+		if op.Op == OpMove || op.Op == OpCopy {
+			p, err := parsePointer(op.From)
+			if err != nil {
+				c.append(op, nil, nil)
+				continue
+			}
+
+			from = p.Parts
+			if from == nil {
+				from = []string{}
+			}
+			if op.Op == OpMove && otEqualPath(from, parts) {
+				continue
+			}
+		}
+
+		if op.Op == OpReplace || op.Op == OpRemove {
+			var keep bool
+			if op, keep = c.simplify(op, parts); !keep {
+				continue
+			}
+		}
+
+		c.append(op, parts, from)
+	}
+
+	return c.ops
+}
+
+// compacter is the result of Compact as it is built. For each operation,
+// it has its path and from path, and whether it is an add or copy that
+// is known to create the value at its path.
+type compacter struct {
+	ops     []*Operation
+	paths   [][]string
+	froms   [][]string
+	created []bool
+}
+
+// append appends the operation op with the path and from path.
+func (c *compacter) append(op *Operation, path, from []string) {
+	created := false
+	if path != nil && (op.Op == OpAdd || op.Op == OpCopy) {
+		created = c.creates(path)
+	}
+
+	c.ops = append(c.ops, op)
+	c.paths = append(c.paths, path)
+	c.froms = append(c.froms, from)
+	c.created = append(c.created, created)
+}
+
+// remove removes the operation at index i.
+func (c *compacter) remove(i int) {
+	c.ops = append(c.ops[:i:i], c.ops[i+1:]...)
+	c.paths = append(c.paths[:i:i], c.paths[i+1:]...)
+	c.froms = append(c.froms[:i:i], c.froms[i+1:]...)
+	c.created = append(c.created[:i:i], c.created[i+1:]...)
+}
+
+// creates returns true if an add at path creates the value rather than
+// replacing an existing one. This is the case for slice inserts and for
+// paths whose value was removed or moved away by the operations so far.
+func (c *compacter) creates(path []string) bool {
+	if otDestKind(path) == otInsert {
+		return true
+	}
+
+	for i := len(c.ops) - 1; i >= 0; i-- {
+		prev, prevPath := c.ops[i], c.paths[i]
+		if prevPath == nil {
+			break
+		}
+
+		switch {
+		case prev.Op == OpRemove && otEqualPath(prevPath, path):
+			return true
+
+		case prev.Op == OpMove && otEqualPath(c.froms[i], path) &&
+			!compactRelated(prev, prevPath, nil, path):
+			// The value is moved away as long as it isn't moved to or
+			// shifted by the value at path.
+			return true
+		}
+
+		if compactRelated(prev, prevPath, c.froms[i], path) {
+			break
+		}
+	}
+
+	return false
+}
+
+// simplify simplifies the earlier operations that are overwritten by the
+// replace or remove op at path. It returns the new operation to append
+// and false if the operation should be dropped.
+func (c *compacter) simplify(op *Operation, path []string) (*Operation, bool) {
+	for i := len(c.ops) - 1; i >= 0; i-- {
+		prev, prevPath := c.ops[i], c.paths[i]
+		if prevPath == nil {
+			break
+		}
+
+		switch {
+		case otEqualPath(prevPath, path):
+			switch prev.Op {
+			case OpReplace, OpIncrement:
+				c.remove(i)
+				continue
+
+			case OpAdd, OpCopy:
+				if op.Op == OpRemove {
+					// Removing a value that was just created cancels out.
+					// If the add may have replaced an existing member then
+					// neither can be dropped: the remove fails without
+					// the add if the member didn't exist.
+					if !c.created[i] {
+						return op, true
+					}
+
+					c.remove(i)
+					return op, false
+				}
+
+				// Replacing a value that was just added adds the new value
+				// instead since the value may not have existed before.
+				// This has the same effect whether or not it did.
+				c.remove(i)
+				add := *op
+				add.Op = OpAdd
+				return &add, true
+			}
+
+		case otPrefix(path, prevPath) && compactWithin(prev, c.froms[i], path):
+			c.remove(i)
+			continue
+		}
+
+		if compactRelated(prev, prevPath, c.froms[i], path) {
+			break
+		}
+	}
+
+	return op, true
+}
+
+// compactWithin returns true if the changes made by op are all within the
+// value at path, so that they can be dropped if it is overwritten.
+func compactWithin(op *Operation, from, path []string) bool {
+	switch op.Op {
+	case OpAdd, OpReplace, OpRemove, OpIncrement, OpCopy:
+		return true
+
+	case OpMove:
+		return otPrefix(path, from)
+	}
+
+	return false
+}
+
+// compactRelated returns true if the operation op with the path prevPath and
+// from path reads or changes the value at path or shifts path.
+func compactRelated(op *Operation, prevPath, from, path []string) bool {
+	// Adding or removing a slice element shifts the elements after it
+	shifts := func(p []string) bool {
+		return otDestKind(p) == otInsert && otPrefix(p[:len(p)-1], path)
+	}
+
+	switch op.Op {
+	case OpAdd, OpRemove, OpCopy:
+		if shifts(prevPath) {
+			return true
+		}
+
+	case OpMove:
+		if shifts(prevPath) || shifts(from) {
+			return true
+		}
+	}
+
+	for _, p := range [][]string{prevPath, from} {
+		if p != nil && (otPrefix(p, path) || otPrefix(path, p)) {
+			return true
+		}
+
+		// If path is a slice element then dropping an earlier add of it
+		// would shift the elements after it for the operations in between.
+		if p != nil && otDestKind(path) == otInsert && otPrefix(path[:len(path)-1], p) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,397 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/copystructure"
+)
+
+func TestCompact(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Input    interface{}
+		Ops      []*Operation
+		Expected []*Operation
+	}{
+		{
+			"empty",
+			map[string]interface{}{},
+			nil,
+			[]*Operation{},
+		},
+
+		{
+			"consecutive replaces",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+				&Operation{Op: OpReplace, Path: "/a", Value: 4},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 4},
+			},
+		},
+
+		{
+			"replaces with unrelated operations",
+			map[string]interface{}{"a": 1, "b": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpReplace, Path: "/b", Value: 2},
+				&Operation{Op: OpAdd, Path: "/c", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/b", Value: 2},
+				&Operation{Op: OpAdd, Path: "/c", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+		},
+
+		{
+			"glob in between",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpTest, Path: "/*", Value: 2, Glob: true},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpTest, Path: "/*", Value: 2, Glob: true},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+		},
+
+		{
+			"replace read in between",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpCopy, From: "/a", Path: "/b"},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpCopy, From: "/a", Path: "/b"},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+		},
+
+		{
+			"replace tested in between",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpTest, Path: "/a", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpTest, Path: "/a", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+		},
+
+		{
+			"replace copied from root in between",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpCopy, From: "", Path: "/b"},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpCopy, From: "", Path: "/b"},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+		},
+
+		{
+			"replace shifted in between",
+			[]interface{}{1, 2},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/1", Value: 3},
+				&Operation{Op: OpAdd, Path: "/0", Value: 4},
+				&Operation{Op: OpReplace, Path: "/1", Value: 5},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/1", Value: 3},
+				&Operation{Op: OpAdd, Path: "/0", Value: 4},
+				&Operation{Op: OpReplace, Path: "/1", Value: 5},
+			},
+		},
+
+		{
+			"add then remove",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/b", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpRemove, Path: "/b"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/b", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpRemove, Path: "/b"},
+			},
+		},
+
+		{
+			"add existing member then remove",
+			map[string]interface{}{"c": nil, "e": 0},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/e", Value: 1},
+				&Operation{Op: OpReplace, Path: "/e", Value: 2},
+				&Operation{Op: OpAdd, Path: "/e", Value: 3},
+				&Operation{Op: OpRemove, Path: "/e"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/e", Value: 2},
+				&Operation{Op: OpAdd, Path: "/e", Value: 3},
+				&Operation{Op: OpRemove, Path: "/e"},
+			},
+		},
+
+		{
+			"add new member then remove",
+			map[string]interface{}{"c": nil},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/e", Value: 1},
+				&Operation{Op: OpReplace, Path: "/e", Value: 2},
+				&Operation{Op: OpAdd, Path: "/e", Value: 3},
+				&Operation{Op: OpRemove, Path: "/e"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/e", Value: 2},
+				&Operation{Op: OpAdd, Path: "/e", Value: 3},
+				&Operation{Op: OpRemove, Path: "/e"},
+			},
+		},
+
+		{
+			"remove, add, then remove",
+			map[string]interface{}{"a": 1, "b": 1},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/b"},
+				&Operation{Op: OpAdd, Path: "/b", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpRemove, Path: "/b"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/b"},
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+			},
+		},
+
+		{
+			"move away, add, then remove",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a", Path: "/b"},
+				&Operation{Op: OpAdd, Path: "/a", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a", Path: "/b"},
+			},
+		},
+
+		{
+			"move to parent, add, then remove",
+			map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": map[string]interface{}{"b": 1},
+				},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a/b", Path: "/a"},
+				&Operation{Op: OpAdd, Path: "/a/b", Value: 2},
+				&Operation{Op: OpRemove, Path: "/a/b"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a/b", Path: "/a"},
+				&Operation{Op: OpAdd, Path: "/a/b", Value: 2},
+				&Operation{Op: OpRemove, Path: "/a/b"},
+			},
+		},
+
+		{
+			"add replace then remove",
+			[]interface{}{1},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/0", Value: 2},
+				&Operation{Op: OpReplace, Path: "/0", Value: 3},
+				&Operation{Op: OpRemove, Path: "/0"},
+			},
+			[]*Operation{},
+		},
+
+		{
+			"add then replace",
+			map[string]interface{}{},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: 1},
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: 2},
+			},
+		},
+
+		{
+			"copy then remove",
+			[]interface{}{1},
+			[]*Operation{
+				&Operation{Op: OpCopy, From: "/0", Path: "/1"},
+				&Operation{Op: OpRemove, Path: "/1"},
+			},
+			[]*Operation{},
+		},
+
+		{
+			"replace then remove",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpIncrement, Path: "/a", Value: 1},
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+		},
+
+		{
+			"remove then remove slice",
+			[]interface{}{1, 2, 3},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/0"},
+				&Operation{Op: OpRemove, Path: "/0"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/0"},
+				&Operation{Op: OpRemove, Path: "/0"},
+			},
+		},
+
+		{
+			"replace under later replace",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 2},
+				&Operation{Op: OpAdd, Path: "/a/c", Value: 2},
+				&Operation{Op: OpMove, From: "/a/c", Path: "/a/d"},
+				&Operation{Op: OpReplace, Path: "/a", Value: "foo"},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: "foo"},
+			},
+		},
+
+		{
+			"replace under later remove",
+			map[string]interface{}{
+				"a": []interface{}{1, 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a/0"},
+				&Operation{Op: OpReplace, Path: "/a/0", Value: 3},
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+		},
+
+		{
+			"replace root",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+				&Operation{Op: OpReplace, Path: "", Value: "foo"},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "", Value: "foo"},
+			},
+		},
+
+		{
+			"move out before replace",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a/b", Path: "/c"},
+				&Operation{Op: OpReplace, Path: "/a", Value: "foo"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a/b", Path: "/c"},
+				&Operation{Op: OpReplace, Path: "/a", Value: "foo"},
+			},
+		},
+
+		{
+			"replace parent first",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: map[string]interface{}{"b": 2}},
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: map[string]interface{}{"b": 2}},
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 3},
+			},
+		},
+
+		{
+			"no-op move",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a", Path: "/a"},
+				&Operation{Op: OpMove, From: "/a", Path: "/b"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a", Path: "/b"},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual := Compact(tc.Ops)
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+
+			// The compacted patch must have the same effect
+			expected := testCompactApply(t, tc.Input, tc.Ops)
+			if result := testCompactApply(t, tc.Input, actual); !reflect.DeepEqual(result, expected) {
+				t.Fatalf("bad result: %#v", result)
+			}
+		})
+	}
+}
+
+func testCompactApply(t *testing.T, v interface{}, ops []*Operation) interface{} {
+	v, err := copystructure.Copy(v)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	v, err = Patch(v, ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return v
+}
@@ -0,0 +1,251 @@
+package patchstructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// conformanceCase is a single test from the json-patch-tests suite
+// (https://github.com/json-patch/json-patch-tests) in testdata.
+type conformanceCase struct {
+	Comment  string          `json:"comment"`
+	Doc      json.RawMessage `json:"doc"`
+	Patch    json.RawMessage `json:"patch"`
+	Expected json.RawMessage `json:"expected"`
+	Error    string          `json:"error"`
+	Disabled bool            `json:"disabled"`
+}
+
+// TestConformance runs the json-patch-tests suite against documents
+// decoded from JSON as well as the same documents decoded into typed Go
+// values. Every enabled test must pass in both forms.
+func TestConformance(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		var cases []conformanceCase
+		if err := json.Unmarshal(raw, &cases); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		for i, tc := range cases {
+			if tc.Disabled {
+				continue
+			}
+
+			name := fmt.Sprintf("%s/%d-%s", filepath.Base(file), i, tc.Comment)
+			t.Run(name+"/json", func(t *testing.T) {
+				testConformance(t, tc, false)
+			})
+			t.Run(name+"/typed", func(t *testing.T) {
+				testConformance(t, tc, true)
+			})
+		}
+	}
+}
+
+func testConformance(t *testing.T, tc conformanceCase, typed bool) {
+	var doc interface{}
+	var err error
+	if typed {
+		doc, err = testConformanceTyped(tc.Doc, tc.Expected)
+	} else {
+		err = json.Unmarshal(tc.Doc, &doc)
+	}
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var ops []*Operation
+	err = json.Unmarshal(tc.Patch, &ops)
+	var actual interface{}
+	if err == nil {
+		actual, err = Patch(doc, ops)
+	}
+
+	if tc.Error != "" {
+		if err == nil {
+			t.Fatalf("expected error: %s", tc.Error)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tc.Expected == nil {
+		return
+	}
+
+	expected, err := testConformanceExpected(tc.Expected, actual, typed)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if typed {
+		// Typed results are compared as JSON values
+		if actual, err = testConformanceJSON(actual); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v\n\nexpected: %#v", actual, expected)
+	}
+}
+
+// testConformanceExpected decodes the expected value of a test. A typed
+// result is compared with the expected value decoded into the same Go type,
+// since a struct field that is removed is set to its zero value rather than
+// deleted.
+func testConformanceExpected(raw []byte, actual interface{}, typed bool) (interface{}, error) {
+	if !typed || actual == nil {
+		var result interface{}
+		err := json.Unmarshal(raw, &result)
+		return result, err
+	}
+
+	result := reflect.New(reflect.TypeOf(actual))
+	if err := json.Unmarshal(raw, result.Interface()); err != nil {
+		return nil, err
+	}
+
+	return testConformanceJSON(result.Elem().Interface())
+}
+
+// testConformanceJSON converts a typed value to the value decoded from its
+// JSON encoding.
+func testConformanceJSON(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	err = json.Unmarshal(raw, &result)
+	return result, err
+}
+
+// testConformanceTyped converts the document of a test to the typed Go
+// value that would be used to represent it. The type is derived from both
+// the document and the expected result so that it can hold either one.
+func testConformanceTyped(doc, expected []byte) (interface{}, error) {
+	var samples []interface{}
+	for _, raw := range [][]byte{doc, expected} {
+		if raw == nil {
+			continue
+		}
+
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		samples = append(samples, v)
+	}
+
+	result := reflect.New(testConformanceType(samples))
+	if err := json.Unmarshal(doc, result.Interface()); err != nil {
+		return nil, err
+	}
+
+	return result.Elem().Interface(), nil
+}
+
+// testConformanceType returns a Go type that can hold each of the decoded
+// JSON values in samples. Objects are structs with a field for each member,
+// named by its json tag, and arrays are typed slices, such as []string or
+// [][]float64. Values that have different types, or may be null, are held
+// by an interface{}.
+func testConformanceType(samples []interface{}) reflect.Type {
+	typeInterface := reflect.TypeOf((*interface{})(nil)).Elem()
+	if len(samples) == 0 {
+		return typeInterface
+	}
+
+	var typ reflect.Type
+	for _, sample := range samples {
+		if sample == nil {
+			return typeInterface
+		}
+		if typ == nil {
+			typ = reflect.TypeOf(sample)
+		}
+		if reflect.TypeOf(sample) != typ {
+			return typeInterface
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.Map:
+		members := make(map[string][]interface{})
+		var keys []string
+		for _, sample := range samples {
+			for k, v := range sample.(map[string]interface{}) {
+				if _, ok := members[k]; !ok {
+					keys = append(keys, k)
+				}
+				members[k] = append(members[k], v)
+			}
+		}
+		sort.Strings(keys)
+
+		fields := make([]reflect.StructField, len(keys))
+		for i, k := range keys {
+			// Members that can't be named by a json tag stay a map
+			if !testConformanceTag(k) {
+				return typ
+			}
+
+			fields[i] = reflect.StructField{
+				Name: fmt.Sprintf("Field%d", i),
+				Type: testConformanceType(members[k]),
+				Tag:  reflect.StructTag(fmt.Sprintf("json:%q", k)),
+			}
+		}
+
+		return reflect.StructOf(fields)
+
+	case reflect.Slice:
+		var elems []interface{}
+		for _, sample := range samples {
+			elems = append(elems, sample.([]interface{})...)
+		}
+
+		return reflect.SliceOf(testConformanceType(elems))
+
+	default:
+		return typ
+	}
+}
+
+// testConformanceTag returns true if the member name k can be used as the
+// name of a json tag.
+func testConformanceTag(k string) bool {
+	if k == "" {
+		return false
+	}
+
+	for _, c := range k {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,513 @@
+package patchstructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// Diff returns the operations that turn the value a into the value b.
+//
+// The result is a list of add, remove, and replace operations such that
+// Patch(a, Diff(a, b)) results in a value that is deeply equal to b. Maps,
+// slices, and arrays are walked recursively so that only the changed
+// elements are represented. Structs and pointers to structs are walked by
+// field so long as every field can be addressed by a path (see the package
+// docs on struct tags). Any other value that differs is replaced as a whole.
+//
+// Slices are diffed by index unless WithSliceKey identifies their elements
+// by a key.
+//
+// The values in the resulting operations are not copied from b. If you
+// intend to modify b after diffing, deep copy the operations or b first.
+func Diff(a, b interface{}, opts ...DiffOption) ([]*Operation, error) {
+	w := diffWalker{concrete: make(map[string][]string)}
+	for _, opt := range opts {
+		opt(&w)
+	}
+	for i, k := range w.keys {
+		pointer, err := parsePointer(k.path)
+		if err != nil {
+			return nil, err
+		}
+
+		w.keys[i].parts = pointer.Parts
+	}
+
+	if err := w.diff(nil, reflect.ValueOf(a), reflect.ValueOf(b)); err != nil {
+		return nil, err
+	}
+
+	return w.ops, nil
+}
+
+// DiffOption is an option for Diff.
+type DiffOption func(*diffWalker)
+
+// WithSliceKey identifies the elements of the slices at path by the value
+// of their key member or field, like the patchMergeKey of a Kubernetes
+// strategic merge patch. Parts of path may be "*" to match any member,
+// field, or element, such as "/pods/*/containers".
+//
+// The elements of keyed slices are diffed with the element that has the
+// same key rather than the same index. Operations that remove or change an
+// element address it with a filter selector such as
+// "/containers[?(@.name=="web")]/image" and have Glob set, so they still
+// apply to the right element if the slice is reordered before the patch is
+// applied. An element that is in both slices but changes position is
+// removed by its key and added at its new index with its value from b,
+// the same as a new element. Only these adds depend on the order of the
+// slice. Move operations are intentionally not produced since the "from"
+// of a move can't address an element by key.
+//
+// The key must be a string, number, or boolean that is unique within the
+// slice. If any element doesn't have such a key, the slice is diffed by
+// index. Since the paths have Glob set, the slice is also diffed by index
+// if a part of its path or a member or field name within its elements is
+// "*" or "**" or contains a filter selector, which would otherwise be glob
+// syntax when the patch is applied.
+func WithSliceKey(path, key string) DiffOption {
+	return func(w *diffWalker) {
+		w.keys = append(w.keys, diffSliceKey{path: path, key: key})
+	}
+}
+
+// diffSliceKey is a slice key set with WithSliceKey.
+type diffSliceKey struct {
+	path  string
+	parts []string
+	key   string
+}
+
+// diffWalker accumulates the operations for a Diff.
+type diffWalker struct {
+	ops  []*Operation
+	keys []diffSliceKey
+
+	// keyed is the depth of keyed elements being diffed. Operations within
+	// them have filter selectors in their paths so they're globs.
+	keyed int
+
+	// concrete maps the path of a keyed element to the path of its index
+	// once the slice has been reordered.
+	concrete map[string][]string
+}
+
+// add appends the operation to the result.
+func (w *diffWalker) add(op *Operation) {
+	if w.keyed > 0 {
+		op.Glob = true
+	}
+
+	w.ops = append(w.ops, op)
+}
+
+func (w *diffWalker) diff(parts []string, a, b reflect.Value) error {
+	// Interfaces are transparent for the purpose of diffing: we care
+	// about what they contain.
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+
+	// If either side is missing or the types don't match then there is
+	// nothing to walk into and the value is replaced wholesale.
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		if !a.IsValid() && !b.IsValid() {
+			return nil
+		}
+
+		w.replace(parts, b)
+		return nil
+	}
+
+	switch a.Kind() {
+	case reflect.Map:
+		if a.IsNil() || b.IsNil() {
+			break
+		}
+
+		return w.diffMap(parts, a, b)
+
+	case reflect.Slice:
+		if a.IsNil() || b.IsNil() {
+			break
+		}
+
+		if key, ok := w.sliceKey(parts); ok && diffGlobSafe(w.concretePath(parts), a, b) {
+			aKeys, aOK := diffKeys(a, key)
+			bKeys, bOK := diffKeys(b, key)
+			if aOK && bOK {
+				return w.diffKeyed(parts, key, a, b, aKeys, bKeys)
+			}
+		}
+
+		return w.diffSlice(parts, a, b)
+
+	case reflect.Array:
+		// Arrays of the same type have the same length so this only
+		// ever diffs the elements.
+		return w.diffSlice(parts, a, b)
+
+	case reflect.Struct:
+		if diffStructFields(a.Type()) {
+			return w.diffStruct(parts, a, b)
+		}
+
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() || a.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+
+		if diffStructFields(a.Type().Elem()) {
+			return w.diffStruct(parts, a.Elem(), b.Elem())
+		}
+	}
+
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		w.replace(parts, b)
+	}
+
+	return nil
+}
+
+func (w *diffWalker) diffMap(parts []string, a, b reflect.Value) error {
+	// Sort the keys so that the resulting operations are deterministic.
+	keys := make(map[string]reflect.Value)
+	for _, k := range a.MapKeys() {
+		keys[fmt.Sprint(k.Interface())] = k
+	}
+	for _, k := range b.MapKeys() {
+		keys[fmt.Sprint(k.Interface())] = k
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		k := keys[name]
+		path := diffAppend(parts, name)
+
+		av := a.MapIndex(k)
+		bv := b.MapIndex(k)
+		switch {
+		case !bv.IsValid():
+			w.add(&Operation{
+				Op:   OpRemove,
+				Path: diffPath(path),
+			})
+
+		case !av.IsValid():
+			w.add(&Operation{
+				Op:    OpAdd,
+				Path:  diffPath(path),
+				Value: bv.Interface(),
+			})
+
+		default:
+			if err := w.diff(path, av, bv); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *diffWalker) diffSlice(parts []string, a, b reflect.Value) error {
+	// Diff the elements that both slices have in common.
+	common := a.Len()
+	if b.Len() < common {
+		common = b.Len()
+	}
+	for i := 0; i < common; i++ {
+		path := diffAppend(parts, fmt.Sprint(i))
+		if err := w.diff(path, a.Index(i), b.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	// Remove trailing elements from the end so that the indexes of the
+	// remaining elements are never shifted.
+	for i := a.Len() - 1; i >= common; i-- {
+		w.add(&Operation{
+			Op:   OpRemove,
+			Path: diffPath(diffAppend(parts, fmt.Sprint(i))),
+		})
+	}
+
+	// Append any new elements.
+	for i := common; i < b.Len(); i++ {
+		w.add(&Operation{
+			Op:    OpAdd,
+			Path:  diffPath(diffAppend(parts, "-")),
+			Value: b.Index(i).Interface(),
+		})
+	}
+
+	return nil
+}
+
+// diffKeyed diffs the slices a and b whose elements have the keys aKeys
+// and bKeys. Elements that were removed are removed first, then the
+// elements are added and moved into the order of b, and finally the
+// elements in both that weren't moved are diffed. Moves are a remove by
+// key and an add since a move can't address its from path by key.
+func (w *diffWalker) diffKeyed(parts []string, key string, a, b reflect.Value, aKeys, bKeys []string) error {
+	inB := make(map[string]bool)
+	for _, k := range bKeys {
+		inB[k] = true
+	}
+
+	var current []string
+	inA := make(map[string]int)
+	for i, k := range aKeys {
+		inA[k] = i
+		if inB[k] {
+			current = append(current, k)
+			continue
+		}
+
+		w.add(&Operation{
+			Op:   OpRemove,
+			Path: diffPath(w.keyedPath(parts, key, k)),
+			Glob: true,
+		})
+	}
+
+	concrete := w.concretePath(parts)
+	moved := make(map[string]bool)
+	for i, k := range bKeys {
+		if _, ok := inA[k]; !ok {
+			w.add(&Operation{
+				Op:    OpAdd,
+				Path:  diffPath(diffAppend(parts, fmt.Sprint(i))),
+				Value: b.Index(i).Interface(),
+			})
+
+			current = append(current[:i], append([]string{k}, current[i:]...)...)
+			continue
+		}
+
+		if current[i] == k {
+			continue
+		}
+
+		// Elements before i are already in place so k is always later.
+		j := i + 1
+		for current[j] != k {
+			j++
+		}
+
+		w.add(&Operation{
+			Op:   OpRemove,
+			Path: diffPath(w.keyedPath(parts, key, k)),
+			Glob: true,
+		})
+		w.add(&Operation{
+			Op:    OpAdd,
+			Path:  diffPath(diffAppend(parts, fmt.Sprint(i))),
+			Value: b.Index(i).Interface(),
+		})
+
+		moved[k] = true
+		current = append(current[:j], current[j+1:]...)
+		current = append(current[:i], append([]string{k}, current[i:]...)...)
+	}
+
+	w.keyed++
+	defer func() { w.keyed-- }()
+	for i, k := range bKeys {
+		j, ok := inA[k]
+		if !ok || moved[k] {
+			continue
+		}
+
+		path := w.keyedPath(parts, key, k)
+		w.concrete[diffPath(path)] = diffAppend(concrete, fmt.Sprint(i))
+		if err := w.diff(path, a.Index(j), b.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sliceKey returns the key of the slices at the path parts, if any.
+func (w *diffWalker) sliceKey(parts []string) (string, bool) {
+	if len(w.keys) == 0 {
+		return "", false
+	}
+
+	parts = w.concretePath(parts)
+	for _, k := range w.keys {
+		if len(k.parts) != len(parts) {
+			continue
+		}
+
+		match := true
+		for i, part := range k.parts {
+			if part != "*" && part != parts[i] {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return k.key, true
+		}
+	}
+
+	return "", false
+}
+
+// keyedPath returns the path of the element with the key value k in the
+// slice at the path parts. The filter selector is appended to the last
+// part unless that is already a keyed element.
+func (w *diffWalker) keyedPath(parts []string, key, k string) []string {
+	filter := fmt.Sprintf("[?(@.%s==%s)]", key, k)
+	if len(parts) == 0 {
+		return []string{filter}
+	}
+	if _, ok := w.concrete[diffPath(parts)]; ok {
+		return diffAppend(parts, filter)
+	}
+
+	last := len(parts) - 1
+	return diffAppend(parts[:last], parts[last]+filter)
+}
+
+// concretePath returns the path parts with the keyed elements replaced by
+// their indexes.
+func (w *diffWalker) concretePath(parts []string) []string {
+	for i := len(parts); i > 0; i-- {
+		if concrete, ok := w.concrete[diffPath(parts[:i])]; ok {
+			return append(append([]string{}, concrete...), parts[i:]...)
+		}
+	}
+
+	return parts
+}
+
+// diffKeys returns the key of each element of the slice v as a literal for
+// a filter selector. It returns false if an element doesn't have a key that
+// is a string, number, or boolean, or if the keys aren't unique.
+func diffKeys(v reflect.Value, key string) ([]string, bool) {
+	if key == "" || strings.ContainsAny(key, " \t=!<>&|.()[]/~\"'") {
+		return nil, false
+	}
+
+	result := make([]string, v.Len())
+	seen := make(map[string]bool)
+	for i := range result {
+		elem := v.Index(i)
+		if !elem.CanInterface() {
+			return nil, false
+		}
+
+		value, err := lookup(&pointerstructure.Pointer{Parts: []string{key}}, elem.Interface(), false)
+		if err != nil {
+			return nil, false
+		}
+
+		value, _ = jsonNumber(testIndirect(value))
+		if !value.IsValid() || (!isNumber(value.Kind()) && value.Kind() != reflect.String && value.Kind() != reflect.Bool) {
+			return nil, false
+		}
+
+		data, err := json.Marshal(value.Interface())
+		if err != nil || seen[string(data)] {
+			return nil, false
+		}
+		seen[string(data)] = true
+
+		// Escape the characters that would otherwise be escaped in the path
+		// since filter selectors aren't unescaped.
+		result[i] = diffKeyReplacer.Replace(string(data))
+	}
+
+	return result, true
+}
+
+var diffKeyReplacer = strings.NewReplacer("/", `\u002f`, "~", `\u007e`)
+
+// diffGlobSafe returns true if none of the path parts or the member and
+// field names within the values are glob syntax.
+func diffGlobSafe(parts []string, values ...reflect.Value) bool {
+	for _, part := range parts {
+		if part == "*" || part == "**" || strings.Contains(part, "[?(") {
+			return false
+		}
+	}
+
+	for _, v := range values {
+		for _, child := range globChildren(indirect(v, false)) {
+			if !diffGlobSafe([]string{child.name}, child.value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (w *diffWalker) diffStruct(parts []string, a, b reflect.Value) error {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := structFieldName(t.Field(i))
+		path := diffAppend(parts, name)
+		if err := w.diff(path, a.Field(i), b.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *diffWalker) replace(parts []string, b reflect.Value) {
+	var value interface{}
+	if b.IsValid() {
+		value = b.Interface()
+	}
+
+	w.add(&Operation{
+		Op:    OpReplace,
+		Path:  diffPath(parts),
+		Value: value,
+	})
+}
+
+// diffAppend appends a part to the parts without modifying the
+// backing array of the original parts.
+func diffAppend(parts []string, part string) []string {
+	result := make([]string, len(parts), len(parts)+1)
+	copy(result, parts)
+	return append(result, part)
+}
+
+// diffPath turns the parts into an escaped pointer string.
+func diffPath(parts []string) string {
+	p := &pointerstructure.Pointer{Parts: parts}
+	return p.String()
+}
+
+// diffStructFields returns true if every field of the struct type t can
+// be addressed by a path so that the struct can be diffed field by field.
+func diffStructFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := structFieldName(t.Field(i)); !ok {
+			return false
+		}
+	}
+
+	return true
+}
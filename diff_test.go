@@ -0,0 +1,575 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/copystructure"
+)
+
+func TestDiff(t *testing.T) {
+	type testStruct struct {
+		Name string
+		Tags []string
+	}
+
+	cases := []struct {
+		Name     string
+		A, B     interface{}
+		Expected []*Operation
+	}{
+		{
+			"equal",
+			map[string]interface{}{"a": 42},
+			map[string]interface{}{"a": 42},
+			nil,
+		},
+
+		{
+			"root primitive",
+			"foo",
+			"bar",
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "", Value: "bar"},
+			},
+		},
+
+		{
+			"root nil",
+			nil,
+			map[string]interface{}{"a": 42},
+			[]*Operation{
+				&Operation{
+					Op:    OpReplace,
+					Path:  "",
+					Value: map[string]interface{}{"a": 42},
+				},
+			},
+		},
+
+		{
+			"map add, remove, and replace",
+			map[string]interface{}{"a": 1, "b": 2},
+			map[string]interface{}{"b": 3, "c": 4},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+				&Operation{Op: OpReplace, Path: "/b", Value: 3},
+				&Operation{Op: OpAdd, Path: "/c", Value: 4},
+			},
+		},
+
+		{
+			"map key escaping",
+			map[string]interface{}{"a/b": 1},
+			map[string]interface{}{"a/b": 2},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a~1b", Value: 2},
+			},
+		},
+
+		{
+			"nested map",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 2},
+			},
+		},
+
+		{
+			"type change",
+			map[string]interface{}{"a": 1},
+			map[string]interface{}{"a": "1"},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: "1"},
+			},
+		},
+
+		{
+			"slice grow",
+			[]interface{}{1, 2},
+			[]interface{}{1, 3, 4, 5},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/1", Value: 3},
+				&Operation{Op: OpAdd, Path: "/-", Value: 4},
+				&Operation{Op: OpAdd, Path: "/-", Value: 5},
+			},
+		},
+
+		{
+			"slice shrink",
+			[]interface{}{1, 2, 3, 4},
+			[]interface{}{1},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/3"},
+				&Operation{Op: OpRemove, Path: "/2"},
+				&Operation{Op: OpRemove, Path: "/1"},
+			},
+		},
+
+		{
+			"struct",
+			map[string]interface{}{
+				"a": testStruct{Name: "foo"},
+			},
+			map[string]interface{}{
+				"a": testStruct{Name: "bar"},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a/Name", Value: "bar"},
+			},
+		},
+
+		{
+			"struct pointer",
+			&testStruct{Name: "foo", Tags: []string{"a"}},
+			&testStruct{Name: "foo", Tags: []string{"a", "b"}},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/Tags/-", Value: "b"},
+			},
+		},
+
+		{
+			"struct with unexported fields",
+			map[string]interface{}{
+				"a": struct{ a, B int }{1, 2},
+			},
+			map[string]interface{}{
+				"a": struct{ a, B int }{1, 3},
+			},
+			[]*Operation{
+				&Operation{
+					Op:    OpReplace,
+					Path:  "/a",
+					Value: struct{ a, B int }{1, 3},
+				},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := Diff(tc.A, tc.B)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+// TestDiff_patch verifies that applying the result of Diff to the
+// original value always results in the target value.
+func TestDiff_patch(t *testing.T) {
+	type testStruct struct {
+		Name  string            `json:"name"`
+		Tags  []string          `json:"tags"`
+		Inner *testStruct       `json:"inner"`
+		Meta  map[string]string `json:"meta"`
+		Array [2]string         `json:"array"`
+	}
+
+	cases := []struct {
+		Name string
+		A, B func() interface{}
+	}{
+		{
+			"maps",
+			func() interface{} {
+				return map[string]interface{}{
+					"a": 1,
+					"b": map[string]interface{}{"c": "d"},
+					"e": []interface{}{1, 2, 3},
+				}
+			},
+			func() interface{} {
+				return map[string]interface{}{
+					"b": map[string]interface{}{"c": "e", "f": 7},
+					"e": []interface{}{1, "2"},
+					"g": nil,
+				}
+			},
+		},
+
+		{
+			"slices",
+			func() interface{} {
+				return []interface{}{
+					map[string]interface{}{"name": "alice"},
+					[]interface{}{1},
+				}
+			},
+			func() interface{} {
+				return []interface{}{
+					map[string]interface{}{"name": "bob"},
+					[]interface{}{1, 2},
+					3,
+				}
+			},
+		},
+
+		{
+			"typed",
+			func() interface{} {
+				return map[string][]int{
+					"a": []int{1, 2, 3},
+					"b": []int{4},
+				}
+			},
+			func() interface{} {
+				return map[string][]int{
+					"a": []int{1, 5},
+					"c": []int{},
+				}
+			},
+		},
+
+		{
+			"structs",
+			func() interface{} {
+				return map[string]interface{}{
+					"a": testStruct{Name: "foo"},
+					"b": []testStruct{{Name: "bar"}},
+				}
+			},
+			func() interface{} {
+				return map[string]interface{}{
+					"a": testStruct{Name: "foo", Tags: []string{"x"}},
+					"b": []testStruct{{Name: "bar"}, {Name: "baz"}},
+				}
+			},
+		},
+
+		{
+			"struct root",
+			func() interface{} {
+				return testStruct{
+					Name:  "foo",
+					Inner: &testStruct{Name: "inner"},
+				}
+			},
+			func() interface{} {
+				return testStruct{
+					Name:  "bar",
+					Inner: &testStruct{Name: "inner", Tags: []string{"a"}},
+					Meta:  map[string]string{"a": "b"},
+					Array: [2]string{"", "a"},
+				}
+			},
+		},
+
+		{
+			"struct pointer root",
+			func() interface{} {
+				return &testStruct{
+					Name: "foo",
+					Meta: map[string]string{"a": "b", "c": "d"},
+				}
+			},
+			func() interface{} {
+				return &testStruct{
+					Name:  "foo",
+					Inner: &testStruct{Name: "inner"},
+					Meta:  map[string]string{"a": "c"},
+				}
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			ops, err := Diff(tc.A(), tc.B())
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			actual, err := Patch(tc.A(), ops)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if expected := tc.B(); !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("bad: %#v\n\nexpected: %#v", actual, expected)
+			}
+		})
+	}
+}
+
+func TestDiff_sliceKey(t *testing.T) {
+	type testContainer struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	}
+
+	type testPod struct {
+		Name       string          `json:"name"`
+		Containers []testContainer `json:"containers"`
+	}
+
+	cases := []struct {
+		Name     string
+		A, B     interface{}
+		Opts     []DiffOption
+		Expected []*Operation
+	}{
+		{
+			"replace by key",
+			map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "web", "image": "nginx:1"},
+					map[string]interface{}{"name": "db", "image": "pg:1"},
+				},
+			},
+			map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "web", "image": "nginx:2"},
+					map[string]interface{}{"name": "db", "image": "pg:1"},
+				},
+			},
+			[]DiffOption{WithSliceKey("/containers", "name")},
+			[]*Operation{
+				&Operation{
+					Op:    OpReplace,
+					Path:  `/containers[?(@.name=="web")]/image`,
+					Value: "nginx:2",
+					Glob:  true,
+				},
+			},
+		},
+
+		{
+			"move, add, and remove",
+			map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "a"},
+					map[string]interface{}{"name": "b"},
+					map[string]interface{}{"name": "c"},
+				},
+			},
+			map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "c"},
+					map[string]interface{}{"name": "d"},
+					map[string]interface{}{"name": "a"},
+				},
+			},
+			[]DiffOption{WithSliceKey("/containers", "name")},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: `/containers[?(@.name=="b")]`, Glob: true},
+				&Operation{Op: OpRemove, Path: `/containers[?(@.name=="c")]`, Glob: true},
+				&Operation{
+					Op:    OpAdd,
+					Path:  "/containers/0",
+					Value: map[string]interface{}{"name": "c"},
+				},
+				&Operation{
+					Op:    OpAdd,
+					Path:  "/containers/1",
+					Value: map[string]interface{}{"name": "d"},
+				},
+			},
+		},
+
+		{
+			"nested keys",
+			[]testPod{
+				{"p", []testContainer{{"a", "x"}, {"b", "x"}}},
+				{"q", []testContainer{{"c", "x"}, {"d", "x"}}},
+			},
+			[]testPod{
+				{"p", []testContainer{{"b", "y"}, {"a", "x"}}},
+				{"q", []testContainer{{"c", "y"}, {"d", "x"}}},
+			},
+			[]DiffOption{
+				WithSliceKey("", "name"),
+				WithSliceKey("/*/containers", "name"),
+			},
+			[]*Operation{
+				&Operation{
+					Op:   OpRemove,
+					Path: `/[?(@.name=="p")]/containers[?(@.name=="b")]`,
+					Glob: true,
+				},
+				&Operation{
+					Op:    OpAdd,
+					Path:  `/[?(@.name=="p")]/containers/0`,
+					Value: testContainer{"b", "y"},
+					Glob:  true,
+				},
+				&Operation{
+					Op:    OpReplace,
+					Path:  `/[?(@.name=="q")]/containers[?(@.name=="c")]/image`,
+					Value: "y",
+					Glob:  true,
+				},
+			},
+		},
+
+		{
+			"root and escaped keys",
+			[]interface{}{map[string]interface{}{"id": "a/~b", "n": 1}},
+			[]interface{}{map[string]interface{}{"id": "a/~b", "n": 2}},
+			[]DiffOption{WithSliceKey("", "id")},
+			[]*Operation{
+				&Operation{
+					Op:    OpReplace,
+					Path:  `/[?(@.id=="a\u002f\u007eb")]/n`,
+					Value: 2,
+					Glob:  true,
+				},
+			},
+		},
+
+		{
+			"duplicate keys",
+			[]interface{}{
+				map[string]interface{}{"id": 1, "n": 1},
+				map[string]interface{}{"id": 1, "n": 2},
+			},
+			[]interface{}{
+				map[string]interface{}{"id": 1, "n": 1},
+				map[string]interface{}{"id": 1, "n": 3},
+			},
+			[]DiffOption{WithSliceKey("", "id")},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/1/n", Value: 3},
+			},
+		},
+
+		{
+			"glob member names",
+			[]interface{}{
+				map[string]interface{}{
+					"name": "a",
+					"m":    map[string]interface{}{"*": 1, "x": 1},
+				},
+			},
+			[]interface{}{
+				map[string]interface{}{
+					"name": "a",
+					"m":    map[string]interface{}{"*": 2, "x": 1},
+				},
+			},
+			[]DiffOption{WithSliceKey("", "name")},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/0/m/*", Value: 2},
+			},
+		},
+
+		{
+			"glob path",
+			map[string]interface{}{
+				"**": []interface{}{map[string]interface{}{"id": 1, "n": 1}},
+			},
+			map[string]interface{}{
+				"**": []interface{}{map[string]interface{}{"id": 1, "n": 2}},
+			},
+			[]DiffOption{WithSliceKey("/*", "id")},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/**/0/n", Value: 2},
+			},
+		},
+
+		{
+			"missing key",
+			[]interface{}{map[string]interface{}{"n": 1}},
+			[]interface{}{map[string]interface{}{"n": 2}},
+			[]DiffOption{WithSliceKey("", "id")},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/0/n", Value: 2},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := Diff(tc.A, tc.B, tc.Opts...)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+
+			a, err := copystructure.Copy(tc.A)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			result, err := Patch(a, actual)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(result, tc.B) {
+				t.Fatalf("bad: %#v\n\nexpected: %#v", result, tc.B)
+			}
+		})
+	}
+}
+
+// TestDiff_sliceKeyPatch verifies that a keyed diff turns the original
+// value into the target value, including after the slice is reordered.
+func TestDiff_sliceKeyPatch(t *testing.T) {
+	containers := func(images ...string) map[string]interface{} {
+		var result []interface{}
+		for i := 0; i < len(images); i += 2 {
+			result = append(result, map[string]interface{}{
+				"name":  images[i],
+				"image": images[i+1],
+				"ports": []interface{}{
+					map[string]interface{}{"port": 80},
+					map[string]interface{}{"port": 443},
+				},
+			})
+		}
+
+		return map[string]interface{}{"containers": result}
+	}
+
+	a := containers("web", "nginx:1", "db", "pg:1", "cache", "redis:1")
+	b := containers("db", "pg:2", "web", "nginx:2", "proxy", "envoy:1")
+	ports := b["containers"].([]interface{})[0].(map[string]interface{})
+	ports["ports"] = []interface{}{map[string]interface{}{"port": 443}}
+
+	ops, err := Diff(a, b,
+		WithSliceKey("/containers", "name"),
+		WithSliceKey("/containers/*/ports", "port"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := Patch(containers("web", "nginx:1", "db", "pg:1", "cache", "redis:1"), ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, b) {
+		t.Fatalf("bad: %#v\n\nexpected: %#v", actual, b)
+	}
+
+	// Apply the patch to the same elements in a different order. The
+	// elements that are changed, removed, or moved are found by key.
+	actual, err = Patch(containers("cache", "redis:1", "web", "nginx:1", "db", "pg:1"), ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, b) {
+		t.Fatalf("bad: %#v\n\nexpected: %#v", actual, b)
+	}
+}
+
+func TestDiff_sliceKeyInvalidPath(t *testing.T) {
+	_, err := Diff(nil, nil, WithSliceKey("containers", "name"))
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("bad: %s", err)
+	}
+}
@@ -0,0 +1,58 @@
+package patchstructure
+
+import (
+	"sync"
+)
+
+// Document is a value that can be patched and read concurrently.
+//
+// Each call to Apply is atomic: readers either see the value before the
+// patch or after it, and a patch that fails leaves the value unmodified.
+// This is implemented by applying patches to a deep copy of the value (see
+// PatchAtomic) and then swapping it in. As a result, values returned by Get
+// and Snapshot are never modified by the Document and can be read without
+// holding any locks. They must not be modified by the caller either.
+type Document struct {
+	lock  sync.RWMutex
+	value interface{}
+}
+
+// NewDocument returns a Document for the value v. The Document takes
+// ownership of v so v must not be modified after calling this.
+func NewDocument(v interface{}) *Document {
+	return &Document{value: v}
+}
+
+// Apply applies the operations ops to the document atomically. The
+// errors are the same as PatchAtomic.
+func (d *Document) Apply(ops []*Operation) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	result, err := PatchAtomic(d.value, ops)
+	if err != nil {
+		return err
+	}
+
+	d.value = result
+	return nil
+}
+
+// Get returns the value at path in the document.
+func (d *Document) Get(path string) (interface{}, error) {
+	pointer, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return getValue(pointer, d.value)
+}
+
+// Snapshot returns the current value of the document.
+func (d *Document) Snapshot() interface{} {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.value
+}
@@ -0,0 +1,122 @@
+package patchstructure
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	d := NewDocument(map[string]interface{}{"a": 1})
+	before := d.Snapshot()
+
+	err := d.Apply([]*Operation{
+		&Operation{Op: OpAdd, Path: "/b", Value: []interface{}{"foo"}},
+		&Operation{Op: OpReplace, Path: "/a", Value: 2},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := d.Get("/b/0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != "foo" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Snapshots from before are never modified
+	if expected := map[string]interface{}{"a": 1}; !reflect.DeepEqual(before, expected) {
+		t.Fatalf("bad: %#v", before)
+	}
+
+	expected := map[string]interface{}{
+		"a": 2,
+		"b": []interface{}{"foo"},
+	}
+	if actual := d.Snapshot(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDocument_null(t *testing.T) {
+	d := NewDocument(nil)
+
+	err := d.Apply([]*Operation{
+		&Operation{Op: OpAdd, Path: "", Value: map[string]interface{}{}},
+		&Operation{Op: OpAdd, Path: "/a", Value: 1},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]interface{}{"a": 1}
+	if actual := d.Snapshot(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDocument_applyError(t *testing.T) {
+	d := NewDocument(map[string]interface{}{"a": 1})
+
+	err := d.Apply([]*Operation{
+		&Operation{Op: OpReplace, Path: "/a", Value: 2},
+		&Operation{Op: OpRemove, Path: "/b"},
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The failed patch isn't applied
+	expected := map[string]interface{}{"a": 1}
+	if actual := d.Snapshot(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDocument_getError(t *testing.T) {
+	d := NewDocument(map[string]interface{}{"a": 1})
+
+	if _, err := d.Get("/b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := d.Get("b"); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestDocument_concurrent(t *testing.T) {
+	d := NewDocument(map[string]interface{}{"count": 0})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := d.Apply([]*Operation{
+				&Operation{Op: OpIncrement, Path: "/count", Value: 1},
+			})
+			if err != nil {
+				t.Errorf("err: %s", err)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			if _, err := d.Get("/count"); err != nil {
+				t.Errorf("err: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	actual, err := d.Get("/count")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != 50 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
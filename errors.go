@@ -0,0 +1,130 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// These are the causes of an operation failing. They're wrapped by the
+// errors returned from this package so they can be checked with errors.Is.
+var (
+	// ErrInvalidPath is returned if a path can't be parsed or if it is
+	// invalid for the operation, such as moving a value into its own child.
+	ErrInvalidPath = errors.New("invalid path")
+
+	// ErrNotFound is returned if a path that must exist doesn't exist.
+	ErrNotFound = errors.New("path not found")
+
+	// ErrInvalidIndex is returned if a slice or array index can't be
+	// parsed or is out of range.
+	ErrInvalidIndex = errors.New("invalid index")
+
+	// ErrTypeMismatch is returned if a value can't be set at a path due
+	// to its type or if a path traverses a value that has no children.
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrTestFailed is returned if the value for a test operation isn't
+	// equal to the value at the path.
+	ErrTestFailed = errors.New("test failed")
+
+	// ErrUnknownOp is returned when applying an unknown operation.
+	ErrUnknownOp = errors.New("unknown operation")
+
+	// ErrConflict is returned if concurrent operations can't be
+	// transformed against each other without losing one of the changes.
+	ErrConflict = errors.New("conflict")
+
+	// ErrDenied is returned if a Policy denies an operation.
+	ErrDenied = errors.New("denied by policy")
+
+	// ErrReadOnly is returned if an operation would change a read-only
+	// struct field. The error is a *ReadOnlyError with the field's path.
+	ErrReadOnly = errors.New("read-only field")
+)
+
+// ReadOnlyError is the cause of a PatchError if an operation would change
+// a struct field with the "readonly" option in its "patchstructure" tag.
+// It wraps ErrReadOnly.
+type ReadOnlyError struct {
+	Path string // Path is the path to the read-only field
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, ErrReadOnly)
+}
+
+// Unwrap returns ErrReadOnly for errors.Is.
+func (e *ReadOnlyError) Unwrap() error {
+	return ErrReadOnly
+}
+
+// PatchError is the error returned when applying an operation fails.
+//
+// Cause is one of the errors above (possibly wrapped with more detail) so
+// errors.Is can be used on a PatchError to determine why it failed.
+type PatchError struct {
+	// Index is the index of the operation within the patch. This is
+	// -1 if the operation was applied directly with Operation.Apply.
+	Index int
+
+	Op   Op     // Op is the operation type that failed
+	Path string // Path is the path of the operation that failed
+	From string // From is the from path of the operation that failed
+
+	Cause error // Cause is the reason the operation failed
+}
+
+func (e *PatchError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("error applying operation %s: %s", e.Op, e.Cause)
+	}
+
+	return fmt.Sprintf(
+		"error applying operation %d (%s): %s", e.Index, e.Op, e.Cause)
+}
+
+// Unwrap returns the cause of the error for errors.Is and errors.As.
+func (e *PatchError) Unwrap() error {
+	return e.Cause
+}
+
+// ValidateError is the error returned by Validate with every operation
+// that failed, in the order of the operations.
+type ValidateError struct {
+	Errors []*PatchError
+}
+
+func (e *ValidateError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = "* " + err.Error()
+	}
+
+	return fmt.Sprintf(
+		"%d operation(s) failed:\n\n%s", len(e.Errors), strings.Join(lines, "\n"))
+}
+
+// Is returns true if the error of any operation matches target. This
+// makes errors.Is check every operation that failed.
+func (e *ValidateError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error of an operation that matches target. This
+// makes errors.As check every operation that failed.
+func (e *ValidateError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
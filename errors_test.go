@@ -0,0 +1,168 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestPatchError(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Ops   []*Operation
+		Input interface{}
+		Index int
+		Err   error
+	}{
+		{
+			"invalid path",
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "a", Value: 42},
+			},
+			map[string]interface{}{},
+			0,
+			ErrInvalidPath,
+		},
+
+		{
+			"not found",
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: 42},
+				&Operation{Op: OpRemove, Path: "/b"},
+			},
+			map[string]interface{}{},
+			1,
+			ErrNotFound,
+		},
+
+		{
+			"not found nested",
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 42},
+			},
+			map[string]interface{}{"a": map[string]interface{}{}},
+			0,
+			ErrNotFound,
+		},
+
+		{
+			"not found struct field",
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/Nope", Value: 42},
+			},
+			&struct{ A int }{},
+			0,
+			ErrNotFound,
+		},
+
+		{
+			"invalid index",
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/5"},
+			},
+			[]interface{}{1, 2},
+			0,
+			ErrInvalidIndex,
+		},
+
+		{
+			"invalid index add",
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/nope", Value: 42},
+			},
+			[]interface{}{1, 2},
+			0,
+			ErrInvalidIndex,
+		},
+
+		{
+			"type mismatch",
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/A", Value: "foo"},
+			},
+			&struct{ A int }{},
+			0,
+			ErrTypeMismatch,
+		},
+
+		{
+			"type mismatch traversal",
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a/b", Value: "foo"},
+			},
+			map[string]interface{}{"a": 42},
+			0,
+			ErrTypeMismatch,
+		},
+
+		{
+			"test failed",
+			[]*Operation{
+				&Operation{Op: OpTest, Path: "/a", Value: 12},
+			},
+			map[string]interface{}{"a": 42},
+			0,
+			ErrTestFailed,
+		},
+
+		{
+			"move into child",
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/a/b", From: "/a"},
+			},
+			map[string]interface{}{"a": map[string]interface{}{}},
+			0,
+			ErrInvalidPath,
+		},
+
+		{
+			"unknown op",
+			[]*Operation{
+				&Operation{Path: "/a"},
+			},
+			map[string]interface{}{},
+			0,
+			ErrUnknownOp,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			_, err := Patch(tc.Input, tc.Ops)
+			if err == nil {
+				t.Fatal("should error")
+			}
+
+			if !errors.Is(err, tc.Err) {
+				t.Fatalf("bad: %s", err)
+			}
+
+			var perr *PatchError
+			if !errors.As(err, &perr) {
+				t.Fatalf("not a PatchError: %#v", err)
+			}
+
+			op := tc.Ops[tc.Index]
+			if perr.Index != tc.Index || perr.Op != op.Op ||
+				perr.Path != op.Path || perr.From != op.From {
+				t.Fatalf("bad: %#v", perr)
+			}
+		})
+	}
+}
+
+func TestPatchError_apply(t *testing.T) {
+	op := &Operation{Op: OpRemove, Path: "/a"}
+	_, err := op.Apply(map[string]interface{}{})
+
+	var perr *PatchError
+	if !errors.As(err, &perr) {
+		t.Fatalf("not a PatchError: %#v", err)
+	}
+	if perr.Index != -1 {
+		t.Fatalf("bad: %#v", perr)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bad: %s", err)
+	}
+}
@@ -0,0 +1,258 @@
+package patchstructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// globFilter is a filter selector in a glob path, such as the
+// [?(@.id=="42")] in "/items[?(@.id=="42")]/qty". It selects the members,
+// fields, or elements of a value that the expression is true for.
+//
+// The expression is a subset of JSONPath filters: conditions joined with
+// "&&" and "||", where "&&" binds tighter. A condition is "@" or "@.name",
+// optionally with more ".name" parts, that is compared to a JSON literal
+// with ==, !=, <, <=, >, or >=. Strings may also be single quoted. A
+// condition without a comparison is true if the path exists.
+type globFilter struct {
+	or [][]globCond // or is a disjunction of conjunctions
+}
+
+// globCond is a single condition of a filter.
+type globCond struct {
+	path  []string    // path is the path within the value after "@"
+	op    string      // op is the comparison or "" to test existence
+	value interface{} // value is the literal to compare to
+}
+
+// match returns true if the filter is true for the value v.
+func (f *globFilter) match(v reflect.Value) bool {
+	for _, and := range f.or {
+		ok := true
+		for _, c := range and {
+			if !c.match(v) {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match returns true if the condition is true for the value v. Paths that
+// don't exist are false for every comparison.
+func (c *globCond) match(v reflect.Value) bool {
+	var doc interface{}
+	if v.IsValid() && v.CanInterface() {
+		doc = v.Interface()
+	}
+
+	target, err := lookup(&pointerstructure.Pointer{Parts: c.path}, doc, false)
+	if err != nil {
+		return false
+	}
+
+	value := reflect.ValueOf(c.value)
+	switch c.op {
+	case "":
+		return true
+	case "==":
+		return testEqual(target, value)
+	case "!=":
+		return !testEqual(target, value)
+	}
+
+	cmp, ok := filterCompare(target, value)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// filterCompare compares two numbers or two strings, returning -1, 0, or
+// 1. The second result is false if they can't be compared.
+func filterCompare(a, b reflect.Value) (int, bool) {
+	a, _ = jsonNumber(testIndirect(a))
+	b, _ = jsonNumber(testIndirect(b))
+	switch {
+	case !a.IsValid() || !b.IsValid():
+		return 0, false
+
+	case isNumber(a.Kind()) && isNumber(b.Kind()):
+		switch {
+		case testEqualNumber(a, b):
+			return 0, true
+		case testFloat(a) < testFloat(b):
+			return -1, true
+		default:
+			return 1, true
+		}
+
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), true
+
+	default:
+		return 0, false
+	}
+}
+
+// parseFilter parses the expression of a filter selector, which is the
+// text between "[?(" and ")]".
+func parseFilter(expr string) (*globFilter, error) {
+	p := &filterParser{s: expr}
+	f := new(globFilter)
+	for {
+		and, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		f.or = append(f.or, and)
+		if !p.consume("||") {
+			break
+		}
+	}
+
+	p.space()
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("unexpected %q in filter", p.s[p.pos:])
+	}
+
+	return f, nil
+}
+
+// filterParser is the state of parsing a filter expression.
+type filterParser struct {
+	s   string
+	pos int
+}
+
+// and parses conditions joined with "&&".
+func (p *filterParser) and() ([]globCond, error) {
+	var result []globCond
+	for {
+		c, err := p.cond()
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, c)
+		if !p.consume("&&") {
+			return result, nil
+		}
+	}
+}
+
+// cond parses a single condition.
+func (p *filterParser) cond() (globCond, error) {
+	var c globCond
+	if !p.consume("@") {
+		return c, fmt.Errorf("filter condition must start with @")
+	}
+
+	for p.pos < len(p.s) && p.s[p.pos] == '.' {
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.s) && !strings.ContainsRune(" \t=!<>&|.()", rune(p.s[p.pos])) {
+			p.pos++
+		}
+		if p.pos == start {
+			return c, fmt.Errorf("empty name in filter")
+		}
+
+		c.path = append(c.path, p.s[start:p.pos])
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return c, nil
+	}
+
+	var err error
+	c.value, err = p.literal()
+	return c, err
+}
+
+// literal parses a JSON literal or a single quoted string.
+func (p *filterParser) literal() (interface{}, error) {
+	p.space()
+	if p.pos == len(p.s) {
+		return nil, fmt.Errorf("missing value in filter")
+	}
+
+	start := p.pos
+	quote := p.s[p.pos]
+	if quote == '"' || quote == '\'' {
+		p.pos++
+		for p.pos < len(p.s) && p.s[p.pos] != quote {
+			if p.s[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.s) {
+			return nil, fmt.Errorf("unterminated string in filter")
+		}
+		p.pos++
+
+		if quote == '\'' {
+			s := p.s[start+1 : p.pos-1]
+			s = strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(s)
+			return s, nil
+		}
+	} else {
+		for p.pos < len(p.s) && !strings.ContainsRune(" \t&|()", rune(p.s[p.pos])) {
+			p.pos++
+		}
+	}
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(p.s[start:p.pos]), &result); err != nil {
+		return nil, fmt.Errorf("invalid value %q in filter", p.s[start:p.pos])
+	}
+
+	return result, nil
+}
+
+// consume skips spaces and then token if it is next, returning true if
+// it was.
+func (p *filterParser) consume(token string) bool {
+	p.space()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+
+	return false
+}
+
+// space skips spaces.
+func (p *filterParser) space() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
@@ -0,0 +1,259 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// expand returns the operations to apply for the operation o against the
+// value v. If o.Glob is false this is o itself. Otherwise, it is a copy of
+// o for each path in v that matches o.Path, in the order that they should
+// be applied.
+//
+// In a glob path, a "*" part matches any single member, field, or element
+// and a "**" part matches zero or more levels of them. Only paths that
+// exist in v match, except that the last part of the path of an "add",
+// "move", or "copy" may be a new member of any value that matches the rest
+// of the path. The operations are applied in the reverse of the order of
+// the paths in v so that removing or adding slice elements doesn't shift
+// the elements of later matches, and values within a matched value are
+// changed before it is.
+//
+// A part may also end with a filter selector such as [?(@.id=="42")],
+// which matches the members, fields, or elements of the value at the rest
+// of the part that the filter is true for. See globFilter for the syntax.
+func (o *Operation) expand(v interface{}) ([]*Operation, error) {
+	if !o.Glob {
+		return []*Operation{o}, nil
+	}
+
+	steps, err := parseGlob(o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &globMatcher{seen: make(map[string]bool)}
+	switch o.Op {
+	case OpAdd, OpMove, OpCopy:
+		g.create = true
+	}
+	g.match(nil, steps, reflect.ValueOf(v))
+
+	result := make([]*Operation, len(g.paths))
+	for i, path := range g.paths {
+		op := *o
+		op.Path = path
+		op.Glob = false
+		result[len(result)-1-i] = &op
+	}
+
+	return result, nil
+}
+
+// globMatcher finds the paths that match a glob path.
+type globMatcher struct {
+	create bool            // create allows the last part to not exist
+	paths  []string        // paths are the matches in order
+	seen   map[string]bool // seen avoids matching a path twice with "**"
+}
+
+// match matches the remaining steps against the value v found at the path
+// prefix.
+func (g *globMatcher) match(prefix []string, steps []globStep, v reflect.Value) {
+	if len(steps) == 0 {
+		path := (&pointerstructure.Pointer{Parts: prefix}).String()
+		if !g.seen[path] {
+			g.seen[path] = true
+			g.paths = append(g.paths, path)
+		}
+
+		return
+	}
+
+	v = indirect(v, false)
+	step, rest := steps[0], steps[1:]
+	part := step.name
+	switch {
+	case step.filter != nil:
+		for _, child := range globChildren(v) {
+			if step.filter.match(child.value) {
+				g.match(globAppend(prefix, child.name), rest, child.value)
+			}
+		}
+
+	case part == "**":
+		g.match(prefix, rest, v)
+		for _, child := range globChildren(v) {
+			g.match(globAppend(prefix, child.name), steps, child.value)
+		}
+
+	case part == "*":
+		for _, child := range globChildren(v) {
+			g.match(globAppend(prefix, child.name), rest, child.value)
+		}
+
+	default:
+		if len(rest) == 0 && g.create && globContainer(v) {
+			g.match(globAppend(prefix, part), rest, reflect.Value{})
+			return
+		}
+
+		for _, child := range globChildren(v) {
+			if child.name == part {
+				g.match(globAppend(prefix, part), rest, child.value)
+				return
+			}
+		}
+	}
+}
+
+// globStep is a step of a glob path. It is either a path part, which may
+// be "*" or "**", or a filter selector.
+type globStep struct {
+	name   string
+	filter *globFilter
+}
+
+// parseGlob parses a glob path into its steps. A part that ends with a
+// filter selector is two steps, its name and then the filter, unless the
+// name is empty.
+func parseGlob(path string) ([]globStep, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if path[0] != '/' {
+		return nil, fmt.Errorf("%w %q: path must begin with '/'", ErrInvalidPath, path)
+	}
+
+	var result []globStep
+	for _, part := range globSplit(path[1:]) {
+		name, expr := part, ""
+		idx := strings.Index(part, "[?(")
+		if idx != -1 {
+			if !strings.HasSuffix(part, ")]") {
+				return nil, fmt.Errorf("%w %q: unterminated filter", ErrInvalidPath, path)
+			}
+
+			name, expr = part[:idx], part[idx+3:len(part)-2]
+		}
+
+		name = strings.Replace(name, "~1", "/", -1)
+		name = strings.Replace(name, "~0", "~", -1)
+		if idx == -1 || name != "" {
+			result = append(result, globStep{name: name})
+		}
+		if idx == -1 {
+			continue
+		}
+
+		f, err := parseFilter(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %s", ErrInvalidPath, path, err)
+		}
+
+		result = append(result, globStep{filter: f})
+	}
+
+	return result, nil
+}
+
+// globSplit splits the path s on "/", except within filter selectors.
+func globSplit(s string) []string {
+	var result []string
+	depth, quote, start := 0, byte(0), 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+
+		case depth > 0 && (c == '"' || c == '\''):
+			quote = c
+
+		case c == '[' && (depth > 0 || strings.HasPrefix(s[i:], "[?(")):
+			depth++
+
+		case c == ']' && depth > 0:
+			depth--
+
+		case c == '/' && depth == 0:
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(result, s[start:])
+}
+
+// globChild is a member, field, or element of a value and the path part
+// that addresses it.
+type globChild struct {
+	name  string
+	value reflect.Value
+}
+
+// globChildren returns the children of the value v. Map members are sorted
+// by name so that the matches are in a consistent order.
+func globChildren(v reflect.Value) []globChild {
+	var result []globChild
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			result = append(result, globChild{
+				name:  fmt.Sprint(k.Interface()),
+				value: v.MapIndex(k),
+			})
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].name < result[j].name
+		})
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			result = append(result, globChild{
+				name:  strconv.Itoa(i),
+				value: v.Index(i),
+			})
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := structFieldName(t.Field(i)); ok {
+				result = append(result, globChild{name: name, value: v.Field(i)})
+			}
+		}
+	}
+
+	return result
+}
+
+// globContainer returns true if the value v can have children added.
+func globContainer(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return true
+
+	case reflect.Ptr:
+		// A nil pointer to a struct is allocated when it is set into
+		return v.Type().Elem().Kind() == reflect.Struct
+
+	default:
+		return false
+	}
+}
+
+// globAppend returns a copy of the parts with part appended.
+func globAppend(parts []string, part string) []string {
+	return append(append(make([]string, 0, len(parts)+1), parts...), part)
+}
@@ -0,0 +1,513 @@
+package patchstructure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestOperationApply_glob(t *testing.T) {
+	type testUser struct {
+		Name   string
+		Active bool
+	}
+
+	users := func() map[string]interface{} {
+		return map[string]interface{}{
+			"users": map[string]interface{}{
+				"alice": map[string]interface{}{"active": true, "tags": []interface{}{}},
+				"bob":   map[string]interface{}{"active": true, "tags": []interface{}{"x"}},
+			},
+		}
+	}
+
+	cases := []struct {
+		Name      string
+		Operation *Operation
+		Input     interface{}
+		Expected  interface{}
+		Err       bool
+	}{
+		{
+			"replace",
+			&Operation{Op: OpReplace, Path: "/users/*/active", Value: false, Glob: true},
+			users(),
+			map[string]interface{}{
+				"users": map[string]interface{}{
+					"alice": map[string]interface{}{"active": false, "tags": []interface{}{}},
+					"bob":   map[string]interface{}{"active": false, "tags": []interface{}{"x"}},
+				},
+			},
+			false,
+		},
+
+		{
+			"add to each",
+			&Operation{Op: OpAdd, Path: "/users/*/tags/-", Value: "y", Glob: true},
+			users(),
+			map[string]interface{}{
+				"users": map[string]interface{}{
+					"alice": map[string]interface{}{"active": true, "tags": []interface{}{"y"}},
+					"bob":   map[string]interface{}{"active": true, "tags": []interface{}{"x", "y"}},
+				},
+			},
+			false,
+		},
+
+		{
+			"add new member",
+			&Operation{Op: OpAdd, Path: "/users/*/admin", Value: false, Glob: true},
+			users(),
+			map[string]interface{}{
+				"users": map[string]interface{}{
+					"alice": map[string]interface{}{"active": true, "admin": false, "tags": []interface{}{}},
+					"bob":   map[string]interface{}{"active": true, "admin": false, "tags": []interface{}{"x"}},
+				},
+			},
+			false,
+		},
+
+		{
+			"replace missing member",
+			&Operation{Op: OpReplace, Path: "/users/*/admin", Value: false, Glob: true},
+			users(),
+			users(),
+			false,
+		},
+
+		{
+			"test",
+			&Operation{Op: OpTest, Path: "/users/*/active", Value: true, Glob: true},
+			users(),
+			users(),
+			false,
+		},
+
+		{
+			"test fails",
+			&Operation{Op: OpTest, Path: "/users/*/tags", Value: []interface{}{}, Glob: true},
+			users(),
+			nil,
+			true,
+		},
+
+		{
+			"remove slice elements",
+			&Operation{Op: OpRemove, Path: "/*", Glob: true},
+			[]interface{}{1, 2, 3},
+			[]interface{}{},
+			false,
+		},
+
+		{
+			"remove at any depth",
+			&Operation{Op: OpRemove, Path: "/**/password", Glob: true},
+			map[string]interface{}{
+				"password": "a",
+				"users": []interface{}{
+					map[string]interface{}{"name": "alice", "password": "b"},
+					map[string]interface{}{"name": "bob"},
+				},
+			},
+			map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"name": "alice"},
+					map[string]interface{}{"name": "bob"},
+				},
+			},
+			false,
+		},
+
+		{
+			"nested matches",
+			&Operation{Op: OpRemove, Path: "/**/a", Glob: true},
+			map[string]interface{}{
+				"a": map[string]interface{}{"a": 1, "b": 2},
+			},
+			map[string]interface{}{},
+			false,
+		},
+
+		{
+			"trailing double star",
+			&Operation{Op: OpReplace, Path: "/a/**", Value: 0, Glob: true},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			map[string]interface{}{"a": 0},
+			false,
+		},
+
+		{
+			"struct fields",
+			&Operation{Op: OpReplace, Path: "/*/Active", Value: true, Glob: true},
+			[]*testUser{{Name: "alice"}, {Name: "bob"}},
+			[]*testUser{{Name: "alice", Active: true}, {Name: "bob", Active: true}},
+			false,
+		},
+
+		{
+			"literal path",
+			&Operation{Op: OpReplace, Path: "/users/bob/active", Value: false, Glob: true},
+			users(),
+			map[string]interface{}{
+				"users": map[string]interface{}{
+					"alice": map[string]interface{}{"active": true, "tags": []interface{}{}},
+					"bob":   map[string]interface{}{"active": false, "tags": []interface{}{"x"}},
+				},
+			},
+			false,
+		},
+
+		{
+			"no matches",
+			&Operation{Op: OpRemove, Path: "/nope/*", Glob: true},
+			users(),
+			users(),
+			false,
+		},
+
+		{
+			"root",
+			&Operation{Op: OpReplace, Path: "", Value: 42, Glob: true},
+			users(),
+			42,
+			false,
+		},
+
+		{
+			"copy from",
+			&Operation{Op: OpCopy, From: "/default", Path: "/users/*/role", Glob: true},
+			map[string]interface{}{
+				"default": "user",
+				"users":   []interface{}{map[string]interface{}{}, map[string]interface{}{}},
+			},
+			map[string]interface{}{
+				"default": "user",
+				"users": []interface{}{
+					map[string]interface{}{"role": "user"},
+					map[string]interface{}{"role": "user"},
+				},
+			},
+			false,
+		},
+
+		{
+			"invalid path",
+			&Operation{Op: OpRemove, Path: "*", Glob: true},
+			users(),
+			nil,
+			true,
+		},
+
+		{
+			"star is literal without glob",
+			&Operation{Op: OpRemove, Path: "/*"},
+			map[string]interface{}{"*": 1, "a": 2},
+			map[string]interface{}{"a": 2},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := tc.Operation.Apply(tc.Input)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v\n\nexpected: %#v", actual, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestOperationApply_globError(t *testing.T) {
+	op := &Operation{Op: OpTest, Path: "/*/active", Value: true, Glob: true}
+	_, err := op.Apply([]interface{}{
+		map[string]interface{}{"active": true},
+		map[string]interface{}{"active": false},
+	})
+
+	var perr *PatchError
+	if !errors.As(err, &perr) || !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if perr.Path != "/1/active" {
+		t.Fatalf("bad: %s", perr.Path)
+	}
+}
+
+func TestPatchWithPolicy_glob(t *testing.T) {
+	var paths []string
+	policy := PolicyFunc(func(req *PolicyRequest) (*Operation, error) {
+		paths = append(paths, req.Operation.Path)
+		if req.Path[1] == "name" {
+			return nil, errors.New("can't remove the name")
+		}
+
+		return req.Operation, nil
+	})
+
+	ops := []*Operation{
+		&Operation{Op: OpRemove, Path: "/metadata/*", Glob: true},
+	}
+	v := map[string]interface{}{
+		"metadata": map[string]interface{}{"id": 1, "name": "foo"},
+	}
+	if _, err := PatchWithPolicy(v, ops, policy); !errors.Is(err, ErrDenied) {
+		t.Fatalf("bad: %s", err)
+	}
+
+	expected := []string{"/metadata/name"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("bad: %#v", paths)
+	}
+}
+
+func TestInvert_glob(t *testing.T) {
+	v := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"active": true},
+			map[string]interface{}{"active": false},
+		},
+	}
+	ops := []*Operation{
+		&Operation{Op: OpRemove, Path: "/users/*/active", Glob: true},
+	}
+
+	inverse, err := Invert(v, ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := PatchAtomic(v, ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result, err = Patch(result, inverse)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, v) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestTransform_glob(t *testing.T) {
+	a := []*Operation{&Operation{Op: OpRemove, Path: "/a/*", Glob: true}}
+	b := []*Operation{&Operation{Op: OpRemove, Path: "/b"}}
+	if _, _, err := Transform(a, b); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestOperationApply_globFilter(t *testing.T) {
+	type testItem struct {
+		ID  string `json:"id"`
+		Qty int    `json:"qty"`
+	}
+
+	items := func() map[string]interface{} {
+		return map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"id": "41", "qty": 1, "tags": []interface{}{"a/b"}},
+				map[string]interface{}{"id": "42", "qty": 2},
+				map[string]interface{}{"id": "43", "qty": 3, "sale": true},
+			},
+		}
+	}
+
+	qty := func(q ...interface{}) map[string]interface{} {
+		v := items()
+		for i, item := range v["items"].([]interface{}) {
+			item.(map[string]interface{})["qty"] = q[i]
+		}
+
+		return v
+	}
+
+	cases := []struct {
+		Name      string
+		Operation *Operation
+		Input     interface{}
+		Expected  interface{}
+		Err       bool
+	}{
+		{
+			"equal string",
+			&Operation{Op: OpReplace, Path: `/items[?(@.id=="42")]/qty`, Value: 5, Glob: true},
+			items(),
+			qty(1, 5, 3),
+			false,
+		},
+
+		{
+			"single quotes and spaces",
+			&Operation{Op: OpReplace, Path: `/items[?( @.id == '42' )]/qty`, Value: 5, Glob: true},
+			items(),
+			qty(1, 5, 3),
+			false,
+		},
+
+		{
+			"number comparison",
+			&Operation{Op: OpReplace, Path: `/items[?(@.qty>=2)]/qty`, Value: 0, Glob: true},
+			items(),
+			qty(1, 0, 0),
+			false,
+		},
+
+		{
+			"and binds tighter than or",
+			&Operation{Op: OpReplace, Path: `/items[?(@.id=="41" || @.qty>1 && @.qty<3)]/qty`, Value: 0, Glob: true},
+			items(),
+			qty(0, 0, 3),
+			false,
+		},
+
+		{
+			"exists",
+			&Operation{Op: OpReplace, Path: `/items[?(@.sale)]/qty`, Value: 0, Glob: true},
+			items(),
+			qty(1, 2, 0),
+			false,
+		},
+
+		{
+			"not equal skips missing",
+			&Operation{Op: OpReplace, Path: `/items[?(@.sale!=true)]/qty`, Value: 0, Glob: true},
+			items(),
+			qty(1, 2, 3),
+			false,
+		},
+
+		{
+			"slash in string",
+			&Operation{Op: OpRemove, Path: `/items[?(@.id=="4/1" || @.id=="42")]`, Glob: true},
+			items(),
+			map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"id": "41", "qty": 1, "tags": []interface{}{"a/b"}},
+					map[string]interface{}{"id": "43", "qty": 3, "sale": true},
+				},
+			},
+			false,
+		},
+
+		{
+			"remove matches",
+			&Operation{Op: OpRemove, Path: `/items[?(@.qty<3)]`, Glob: true},
+			items(),
+			map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"id": "43", "qty": 3, "sale": true},
+				},
+			},
+			false,
+		},
+
+		{
+			"current value",
+			&Operation{Op: OpRemove, Path: `/[?(@>1)]`, Glob: true},
+			[]interface{}{1, 2, 3},
+			[]interface{}{1},
+			false,
+		},
+
+		{
+			"add to matches",
+			&Operation{Op: OpAdd, Path: `/items[?(@.id=="41")]/tags/-`, Value: "c", Glob: true},
+			items(),
+			func() interface{} {
+				v := items()
+				item := v["items"].([]interface{})[0].(map[string]interface{})
+				item["tags"] = []interface{}{"a/b", "c"}
+				return v
+			}(),
+			false,
+		},
+
+		{
+			"struct fields",
+			&Operation{Op: OpReplace, Path: `/[?(@.id=="42")]/qty`, Value: 5, Glob: true},
+			[]*testItem{{ID: "41", Qty: 1}, {ID: "42", Qty: 2}},
+			[]*testItem{{ID: "41", Qty: 1}, {ID: "42", Qty: 5}},
+			false,
+		},
+
+		{
+			"json number",
+			&Operation{Op: OpReplace, Path: `/[?(@.qty==2)]/qty`, Value: 5, Glob: true},
+			[]interface{}{map[string]interface{}{"qty": json.Number("2")}},
+			[]interface{}{map[string]interface{}{"qty": 5}},
+			false,
+		},
+
+		{
+			"no matches",
+			&Operation{Op: OpReplace, Path: `/items[?(@.id=="99")]/qty`, Value: 5, Glob: true},
+			items(),
+			items(),
+			false,
+		},
+
+		{
+			"invalid filter",
+			&Operation{Op: OpReplace, Path: `/items[?(id=="42")]/qty`, Value: 5, Glob: true},
+			items(),
+			nil,
+			true,
+		},
+
+		{
+			"invalid literal",
+			&Operation{Op: OpReplace, Path: `/items[?(@.id==42x)]/qty`, Value: 5, Glob: true},
+			items(),
+			nil,
+			true,
+		},
+
+		{
+			"unterminated filter",
+			&Operation{Op: OpReplace, Path: `/items[?(@.id=="42"/qty`, Value: 5, Glob: true},
+			items(),
+			nil,
+			true,
+		},
+
+		{
+			"bracket in plain part",
+			&Operation{Op: OpReplace, Path: `/a[0]/b`, Value: 5, Glob: true},
+			map[string]interface{}{"a[0]": map[string]interface{}{"b": 1}},
+			map[string]interface{}{"a[0]": map[string]interface{}{"b": 5}},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := tc.Operation.Apply(tc.Input)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Fatalf("bad: %s", err)
+				}
+
+				return
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v\n\nexpected: %#v", actual, tc.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// Invert returns the operations that undo the operations ops.
+//
+// The value v must be the value prior to applying ops. Applying the result
+// of Invert to the result of Patch(v, ops) results in a value that is deeply
+// equal to v. This can be used to implement undo for a log of patches.
+//
+// The value v isn't modified: the operations are applied to a deep copy of
+// v in order to determine the values that each operation overwrites. An
+// error is returned if any of the operations fail to apply.
+func Invert(v interface{}, ops []*Operation) ([]*Operation, error) {
+	current, err := copyValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Operation
+	for i, op := range ops {
+		// Glob operations are inverted for each path that they match
+		expanded, err := op.expand(current)
+		if err != nil {
+			return nil, fmt.Errorf("error inverting operation %d: %w", i, err)
+		}
+
+		for _, op := range expanded {
+			var inverse []*Operation
+			inverse, current, err = invertApply(op, current)
+			if err != nil {
+				return nil, fmt.Errorf("error inverting operation %d: %w", i, err)
+			}
+
+			// The inverse of the last operation must be applied first
+			result = append(inverse, result...)
+		}
+	}
+
+	return result, nil
+}
+
+// invertApply returns the inverse of the operation op against the value v
+// and then applies the operation to v, returning the result.
+func invertApply(op *Operation, v interface{}) ([]*Operation, interface{}, error) {
+	var inverse []*Operation
+	var err error
+	switch op.Op {
+	case OpAdd, OpCopy:
+		inverse, err = invertAdd(op.Path, v)
+
+	case OpRemove:
+		inverse, err = invertRemove(op.Path, v)
+
+	case OpReplace:
+		inverse, err = invertReplace(op.Path, v)
+
+	case OpMove:
+		return invertMove(op, v)
+
+	case OpIncrement:
+		inverse, err = invertIncrement(op, v)
+
+	case OpTest:
+		// Test doesn't modify the value so there is nothing to undo
+
+	default:
+		err = fmt.Errorf("%w: can't invert operation %s", ErrUnknownOp, op.Op)
+	}
+	if err != nil {
+		return nil, v, err
+	}
+
+	v, err = op.Apply(v)
+	return inverse, v, err
+}
+
+// invertAdd returns the inverse of adding a value at path in v.
+func invertAdd(path string, v interface{}) ([]*Operation, error) {
+	pointer, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Adding to the root replaces the whole document
+	if pointer.IsRoot() {
+		return invertReplace(path, v)
+	}
+
+	// If the add allocates structs along the way then we restore
+	// the nil pointer.
+	if prefix, ok := invertNilPrefix(pointer, v); ok {
+		return invertReplace(prefix.String(), v)
+	}
+
+	parent, err := invertParent(pointer, v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parent.Kind() {
+	case reflect.Map:
+		// Adding to a nil map allocates it so we restore the nil map
+		if parent.IsNil() {
+			return invertReplace(pointer.Parent().String(), v)
+		}
+
+		// If the key already exists the add replaced it, otherwise
+		// the key is new and must be removed.
+		if _, err := getValue(pointer, v); err == nil {
+			return invertReplace(path, v)
+		}
+
+	case reflect.Slice:
+		// Adds to slices insert so we remove the index. An append is
+		// resolved to the index it will be appended at.
+		if pointer.Parts[len(pointer.Parts)-1] == "-" {
+			pointer = pointer.Parent()
+			pointer.Parts = append(pointer.Parts, fmt.Sprint(parent.Len()))
+			path = pointer.String()
+		}
+
+	case reflect.Array, reflect.Struct:
+		// Adds to arrays and structs overwrite the existing value
+		return invertReplace(path, v)
+	}
+
+	return []*Operation{
+		&Operation{
+			Op:   OpRemove,
+			Path: path,
+		},
+	}, nil
+}
+
+// invertRemove returns the inverse of removing the value at path in v.
+func invertRemove(path string, v interface{}) ([]*Operation, error) {
+	pointer, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if pointer.IsRoot() {
+		return invertReplace(path, v)
+	}
+
+	parent, err := invertParent(pointer, v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parent.Kind() {
+	case reflect.Array:
+		// Removing from an array shifts the remaining elements in place,
+		// so the simplest inverse is to restore the entire array.
+		return invertReplace(pointer.Parent().String(), v)
+
+	case reflect.Struct:
+		// Struct fields are set to zero rather than removed
+		return invertReplace(path, v)
+	}
+
+	old, err := invertValue(pointer, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Operation{
+		&Operation{
+			Op:    OpAdd,
+			Path:  path,
+			Value: old,
+		},
+	}, nil
+}
+
+// invertReplace returns the inverse of replacing the value at path in v.
+func invertReplace(path string, v interface{}) ([]*Operation, error) {
+	pointer, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := invertValue(pointer, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Operation{
+		&Operation{
+			Op:    OpReplace,
+			Path:  path,
+			Value: old,
+		},
+	}, nil
+}
+
+// invertIncrement returns the inverse of the increment operation op against
+// v. Integers are decremented by the same amount so that the inverse
+// doesn't depend on the current value. Floats aren't exact so their
+// previous value is restored.
+func invertIncrement(op *Operation, v interface{}) ([]*Operation, error) {
+	pointer, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := lookup(pointer, v, false)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := indirect(reflect.ValueOf(op.Value), false)
+	if k := indirect(target, false).Kind(); testIsInt(k) || testIsUint(k) {
+		if delta.IsValid() && isNumber(delta.Kind()) {
+			if d, err := incrementInt(delta); err == nil {
+				if d.Neg(d); d.IsInt64() {
+					return []*Operation{
+						&Operation{
+							Op:    OpIncrement,
+							Path:  op.Path,
+							Value: d.Int64(),
+						},
+					}, nil
+				}
+			}
+		}
+	}
+
+	return invertReplace(op.Path, v)
+}
+
+// invertMove returns the inverse of the move operation op against v and
+// applies it. A move is a remove followed by an add so we invert each of
+// those against the value at that point in time.
+func invertMove(op *Operation, v interface{}) ([]*Operation, interface{}, error) {
+	from, err := parsePointer(op.From)
+	if err != nil {
+		return nil, v, err
+	}
+
+	fromValue, err := getValue(from, v)
+	if err != nil {
+		return nil, v, err
+	}
+
+	removeOp := &Operation{Op: OpRemove, Path: op.From}
+	removeInverse, v, err := invertApply(removeOp, v)
+	if err != nil {
+		return nil, v, err
+	}
+
+	addOp := &Operation{Op: OpAdd, Path: op.Path, Value: fromValue}
+	addInverse, v, err := invertApply(addOp, v)
+	if err != nil {
+		return nil, v, err
+	}
+
+	// If the inverse is to remove the value we added and add it back at
+	// the original location then this is just a move in reverse. This
+	// is only valid if the reverse move doesn't move into a child path,
+	// which happens when the value was moved to one of its parents.
+	if len(removeInverse) == 1 && removeInverse[0].Op == OpAdd &&
+		len(addInverse) == 1 && addInverse[0].Op == OpRemove {
+		to, err := parsePointer(addInverse[0].Path)
+		if err != nil {
+			return nil, v, err
+		}
+
+		if !invertIsPrefix(to, from) {
+			return []*Operation{
+				&Operation{
+					Op:   OpMove,
+					Path: op.From,
+					From: addInverse[0].Path,
+				},
+			}, v, nil
+		}
+	}
+
+	return append(addInverse, removeInverse...), v, nil
+}
+
+// invertIsPrefix returns true if pointer p is a proper prefix of pointer
+// child.
+func invertIsPrefix(p, child *pointerstructure.Pointer) bool {
+	if len(p.Parts) >= len(child.Parts) {
+		return false
+	}
+
+	for i, part := range p.Parts {
+		if child.Parts[i] != part {
+			return false
+		}
+	}
+
+	return true
+}
+
+// invertParent returns the parent of the value at pointer p in v,
+// dereferenced so that its kind can be checked.
+func invertParent(p *pointerstructure.Pointer, v interface{}) (reflect.Value, error) {
+	parent, err := lookup(p.Parent(), v, false)
+	if err != nil {
+		return parent, err
+	}
+
+	return indirect(parent, false), nil
+}
+
+// invertNilPrefix returns the pointer to the first nil pointer along the
+// path of pointer p in v. These are the structs that are allocated when
+// a value is set at p.
+func invertNilPrefix(p *pointerstructure.Pointer, v interface{}) (*pointerstructure.Pointer, bool) {
+	for i := 1; i < len(p.Parts); i++ {
+		prefix := &pointerstructure.Pointer{Parts: p.Parts[:i]}
+		val, err := lookup(prefix, v, false)
+		if err != nil {
+			return nil, false
+		}
+
+		if val = indirect(val, false); val.Kind() == reflect.Ptr && val.IsNil() {
+			return prefix, true
+		}
+	}
+
+	return nil, false
+}
+
+// invertValue returns a deep copy of the value at pointer p in v. We
+// copy the value since the operations that follow may modify it.
+func invertValue(p *pointerstructure.Pointer, v interface{}) (interface{}, error) {
+	old, err := getValue(p, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyValue(old)
+}
@@ -0,0 +1,388 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInvert(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Input    interface{}
+		Ops      []*Operation
+		Expected []*Operation
+		Err      bool
+	}{
+		{
+			"add new member",
+			map[string]interface{}{},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: 42},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			false,
+		},
+
+		{
+			"add existing member",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: 42},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 12},
+			},
+			false,
+		},
+
+		{
+			"add slice append",
+			[]interface{}{1, 2},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/-", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/2"},
+			},
+			false,
+		},
+
+		{
+			"remove",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: 12},
+			},
+			false,
+		},
+
+		{
+			"replace",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 42},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 12},
+			},
+			false,
+		},
+
+		{
+			"move",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/b", From: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/a", From: "/b"},
+			},
+			false,
+		},
+
+		{
+			"move slice append",
+			[]interface{}{1, 2, 3},
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/-", From: "/0"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/0", From: "/2"},
+			},
+			false,
+		},
+
+		{
+			"move overwrite",
+			map[string]interface{}{"a": 12, "b": 42},
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/b", From: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/b", Value: 42},
+				&Operation{Op: OpAdd, Path: "/a", Value: 12},
+			},
+			false,
+		},
+
+		{
+			"copy",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpCopy, Path: "/b", From: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/b"},
+			},
+			false,
+		},
+
+		{
+			"inc",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpIncrement, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpIncrement, Path: "/a", Value: int64(-2)},
+			},
+			false,
+		},
+
+		{
+			"inc float",
+			map[string]interface{}{"a": 1.5},
+			[]*Operation{
+				&Operation{Op: OpIncrement, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 1.5},
+			},
+			false,
+		},
+
+		{
+			"test",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpTest, Path: "/a", Value: 12},
+			},
+			nil,
+			false,
+		},
+
+		{
+			"sequence",
+			map[string]interface{}{"a": 12},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/b", Value: 42},
+				&Operation{Op: OpReplace, Path: "/a", Value: 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 12},
+				&Operation{Op: OpRemove, Path: "/b"},
+			},
+			false,
+		},
+
+		{
+			"null document",
+			nil,
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "", Value: 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "", Value: nil},
+			},
+			false,
+		},
+
+		{
+			"remove null member",
+			map[string]interface{}{"a": nil},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: nil},
+			},
+			false,
+		},
+
+		{
+			"replace null member",
+			map[string]interface{}{"a": nil},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: nil},
+			},
+			false,
+		},
+
+		{
+			"move to parent",
+			[]interface{}{[]interface{}{1}},
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/0", From: "/0/0"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/0"},
+				&Operation{Op: OpAdd, Path: "/0/0", Value: 1},
+			},
+			false,
+		},
+
+		{
+			"failed operation",
+			map[string]interface{}{},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			nil,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := Invert(tc.Input, tc.Ops)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+// TestInvert_patch verifies that applying the inverse of a patch to the
+// patched value always results in the original value.
+func TestInvert_patch(t *testing.T) {
+	type testStruct struct {
+		Name  string
+		Tags  []string
+		Array [3]int
+		Inner *testStruct
+		Meta  map[string]string
+	}
+
+	cases := []struct {
+		Name  string
+		Input func() interface{}
+		Ops   []*Operation
+	}{
+		{
+			"maps",
+			func() interface{} {
+				return map[string]interface{}{
+					"a": 1,
+					"b": map[string]interface{}{"c": "d"},
+				}
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/b/e", Value: "f"},
+				&Operation{Op: OpReplace, Path: "/b/c", Value: "g"},
+				&Operation{Op: OpMove, Path: "/a", From: "/b"},
+				&Operation{Op: OpCopy, Path: "/b", From: "/a"},
+				&Operation{Op: OpRemove, Path: "/a/e"},
+				&Operation{Op: OpAdd, Path: "/n", Value: uint8(1)},
+				&Operation{Op: OpIncrement, Path: "/n", Value: 254},
+			},
+		},
+
+		{
+			"slices",
+			func() interface{} {
+				return []interface{}{1, 2, []interface{}{3, 4}}
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/1", Value: 5},
+				&Operation{Op: OpRemove, Path: "/0"},
+				&Operation{Op: OpMove, Path: "/1/1", From: "/0"},
+				&Operation{Op: OpAdd, Path: "/1/-", Value: 6},
+				&Operation{Op: OpCopy, Path: "/-", From: "/1"},
+			},
+		},
+
+		{
+			"structs",
+			func() interface{} {
+				return &testStruct{
+					Name:  "foo",
+					Tags:  []string{"a", "b"},
+					Array: [3]int{1, 2, 3},
+				}
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/Name", Value: "bar"},
+				&Operation{Op: OpRemove, Path: "/Tags/0"},
+				&Operation{Op: OpRemove, Path: "/Array/0"},
+				&Operation{Op: OpAdd, Path: "/Inner/Name", Value: "baz"},
+				&Operation{Op: OpMove, Path: "/Array/1", From: "/Array/0"},
+				&Operation{Op: OpMove, Path: "/Name", From: "/Inner/Name"},
+				&Operation{Op: OpAdd, Path: "/Meta/a", Value: "b"},
+			},
+		},
+
+		{
+			"nulls",
+			func() interface{} {
+				return map[string]interface{}{"a": nil, "b": nil}
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+				&Operation{Op: OpReplace, Path: "/b", Value: 1},
+				&Operation{Op: OpAdd, Path: "/c", Value: nil},
+			},
+		},
+
+		{
+			"move to parent",
+			func() interface{} {
+				return []interface{}{[]interface{}{1}, map[string]interface{}{
+					"a": map[string]interface{}{"b": 2},
+				}}
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, Path: "/0", From: "/0/0"},
+				&Operation{Op: OpMove, Path: "/2", From: "/2/a"},
+			},
+		},
+
+		{
+			"null root",
+			func() interface{} {
+				return nil
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "", Value: "foo"},
+			},
+		},
+
+		{
+			"root",
+			func() interface{} {
+				return map[string]interface{}{"a": 1}
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "", Value: "foo"},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			inverse, err := Invert(tc.Input(), tc.Ops)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			value, err := Patch(tc.Input(), tc.Ops)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			actual, err := Patch(value, inverse)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if expected := tc.Input(); !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("bad: %#v\n\nexpected: %#v", actual, expected)
+			}
+		})
+	}
+}
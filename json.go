@@ -0,0 +1,295 @@
+package patchstructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// PatchJSON applies the JSON encoded patch to the JSON document doc and
+// returns the JSON encoded result. This is useful for applying
+// "application/json-patch+json" requests directly to stored documents.
+//
+// Numbers in the document and the patch are decoded as json.Number so
+// they're encoded without loss of precision, and object members are
+// encoded in the order they appeared in the document or patch. Members
+// that are added to an existing object follow its existing members, and
+// objects with no original order, such as those deep copied by "copy", are
+// encoded with sorted keys like encoding/json.
+//
+// Errors applying the patch are the same as Patch. The patch is applied
+// atomically since the document is decoded into new values.
+func PatchJSON(doc []byte, patch []byte) ([]byte, error) {
+	d := &jsonDecoder{order: make(map[uintptr]jsonObject)}
+
+	v, err := d.decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding document: %w", err)
+	}
+
+	ops, err := d.patch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err = Patch(v, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := d.encode(&buf, v); err != nil {
+		return nil, fmt.Errorf("error encoding result: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ParsePatch decodes a JSON encoded patch from r.
+//
+// This differs from decoding the operations with encoding/json in that
+// numbers in values are decoded as json.Number rather than float64. A
+// json.Number is converted exactly when it is set into a typed location,
+// so integers that can't be represented by a float64, such as large int64
+// IDs, are patched without loss of precision.
+func ParsePatch(r io.Reader) ([]*Operation, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(jsonDecoder).patch(data)
+}
+
+// jsonDecoder decodes JSON values while recording the order of the members
+// of each object so they can be encoded in the same order.
+type jsonDecoder struct {
+	// order is keyed by the map pointer. The map is kept with its keys so
+	// its address can't be reused by another map while encoding. If order
+	// is nil then the order isn't recorded.
+	order map[uintptr]jsonObject
+}
+
+type jsonObject struct {
+	m    map[string]interface{}
+	keys []string
+}
+
+// patch decodes the patch in data. Values are decoded with decode.
+func (d *jsonDecoder) patch(data []byte) ([]*Operation, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error decoding patch: %w", err)
+	}
+
+	ops := make([]*Operation, len(raw))
+	for i, r := range raw {
+		var op Operation
+		if err := json.Unmarshal(r, &op); err != nil {
+			return nil, fmt.Errorf("error decoding patch operation %d: %w", i, err)
+		}
+
+		// Decode the value again to keep its numbers and member order
+		var value struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(r, &value); err != nil {
+			return nil, fmt.Errorf("error decoding patch operation %d: %w", i, err)
+		}
+		if value.Value != nil {
+			v, err := d.decode(value.Value)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding patch operation %d: %w", i, err)
+			}
+
+			op.Value = v
+		}
+
+		ops[i] = &op
+	}
+
+	return ops, nil
+}
+
+// decode decodes the single JSON value in data. Numbers are decoded as
+// json.Number.
+func (d *jsonDecoder) decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	v, err := d.value(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid data after top-level value")
+	}
+
+	return v, nil
+}
+
+func (d *jsonDecoder) value(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := make(map[string]interface{})
+		var keys []string
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			key := tok.(string)
+			v, err := d.value(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := m[key]; !ok {
+				keys = append(keys, key)
+			}
+			m[key] = v
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		if d.order != nil {
+			d.order[reflect.ValueOf(m).Pointer()] = jsonObject{m: m, keys: keys}
+		}
+		return m, nil
+
+	case json.Delim('['):
+		s := make([]interface{}, 0)
+		for dec.More() {
+			v, err := d.value(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			s = append(s, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+
+	default:
+		return tok, nil
+	}
+}
+
+// encode writes v as JSON to buf with the members of objects decoded by d
+// in their original order.
+func (d *jsonDecoder) encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		// Known keys in their original order and then new keys sorted
+		var keys []string
+		seen := make(map[string]bool)
+		if obj, ok := d.order[reflect.ValueOf(v).Pointer()]; ok {
+			for _, k := range obj.keys {
+				if _, ok := v[k]; ok {
+					keys = append(keys, k)
+					seen[k] = true
+				}
+			}
+		}
+		start := len(keys)
+		for k := range v {
+			if !seen[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys[start:])
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			raw, err := json.Marshal(k)
+			if err != nil {
+				return err
+			}
+			buf.Write(raw)
+			buf.WriteByte(':')
+
+			if err := d.encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case []interface{}:
+		if v == nil {
+			buf.WriteString("null")
+			return nil
+		}
+
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := d.encode(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(raw)
+		return nil
+	}
+}
+
+// jsonNumberType is the type of json.Number.
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// jsonNumber converts v to an int64, uint64, or float64 value if it is a
+// json.Number, in that order of preference so integers are exact. This
+// returns false if v isn't a json.Number or isn't a valid number.
+func jsonNumber(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() || v.Type() != jsonNumberType {
+		return v, false
+	}
+
+	s := v.String()
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return reflect.ValueOf(n), true
+	}
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return reflect.ValueOf(n), true
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return reflect.ValueOf(n), true
+	}
+
+	return v, false
+}
@@ -0,0 +1,209 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatchJSON(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Doc      string
+		Patch    string
+		Expected string
+		Err      bool
+	}{
+		{
+			"key order",
+			`{"z": 1, "a": {"y": 2, "b": 3}}`,
+			`[{"op": "add", "path": "/a/c", "value": 4}]`,
+			`{"z":1,"a":{"y":2,"b":3,"c":4}}`,
+			false,
+		},
+
+		{
+			"new keys sorted",
+			`{"z": 1}`,
+			`[
+				{"op": "add", "path": "/b", "value": 2},
+				{"op": "add", "path": "/a", "value": 3}
+			]`,
+			`{"z":1,"a":3,"b":2}`,
+			false,
+		},
+
+		{
+			"replaced key keeps position",
+			`{"z": 1, "a": 2}`,
+			`[{"op": "replace", "path": "/z", "value": 3}]`,
+			`{"z":3,"a":2}`,
+			false,
+		},
+
+		{
+			"value key order",
+			`{}`,
+			`[{"op": "add", "path": "/a", "value": {"z": 1, "a": 2}}]`,
+			`{"a":{"z":1,"a":2}}`,
+			false,
+		},
+
+		{
+			"moved object keeps order",
+			`{"a": {"z": 1, "a": 2}}`,
+			`[{"op": "move", "from": "/a", "path": "/b"}]`,
+			`{"b":{"z":1,"a":2}}`,
+			false,
+		},
+
+		{
+			"number precision",
+			`{"id": 9007199254740993, "f": 1.10}`,
+			`[{"op": "add", "path": "/other", "value": 9007199254740995}]`,
+			`{"id":9007199254740993,"f":1.10,"other":9007199254740995}`,
+			false,
+		},
+
+		{
+			"test number precision",
+			`{"id": 9007199254740993}`,
+			`[{"op": "test", "path": "/id", "value": 9007199254740992}]`,
+			"",
+			true,
+		},
+
+		{
+			"test number and string",
+			`{"id": 10}`,
+			`[{"op": "test", "path": "/id", "value": "10"}]`,
+			"",
+			true,
+		},
+
+		{
+			"increment",
+			`{"id": 9007199254740993}`,
+			`[{"op": "inc", "path": "/id", "value": 2}]`,
+			`{"id":9007199254740995}`,
+			false,
+		},
+
+		{
+			"arrays",
+			`[1, [], {"b": null, "a": true}]`,
+			`[{"op": "remove", "path": "/0"}]`,
+			`[[],{"b":null,"a":true}]`,
+			false,
+		},
+
+		{
+			"null value",
+			`{"a": 1}`,
+			`[{"op": "replace", "path": "/a", "value": null}]`,
+			`{"a":null}`,
+			false,
+		},
+
+		{
+			"invalid document",
+			`{"a": 1`,
+			`[]`,
+			"",
+			true,
+		},
+
+		{
+			"trailing data in document",
+			`{"a": 1} {}`,
+			`[]`,
+			"",
+			true,
+		},
+
+		{
+			"invalid patch",
+			`{}`,
+			`[{"op": "add", "path": "/a"}]`,
+			"",
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := PatchJSON([]byte(tc.Doc), []byte(tc.Patch))
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if string(actual) != tc.Expected {
+				t.Fatalf("bad: %s\n\nexpected: %s", actual, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestPatchJSON_patchError(t *testing.T) {
+	_, err := PatchJSON(
+		[]byte(`{"a": 1}`),
+		[]byte(`[{"op": "test", "path": "/a", "value": 1}, {"op": "remove", "path": "/b"}]`))
+
+	var perr *PatchError
+	if !errors.As(err, &perr) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if perr.Index != 1 || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	type testInner struct {
+		ID int64 `json:"id"`
+	}
+
+	ops, err := ParsePatch(strings.NewReader(`[
+		{"op": "test", "path": "/0/id", "value": 9007199254740993},
+		{"op": "add", "path": "/0/id", "value": 9007199254740995},
+		{"op": "add", "path": "/-", "value": {"id": 9007199254740997}}
+	]`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := Patch([]testInner{{ID: 9007199254740993}}, ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []testInner{{ID: 9007199254740995}, {ID: 9007199254740997}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v\n\nexpected: %#v", actual, expected)
+	}
+}
+
+func TestParsePatch_invalid(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Patch string
+	}{
+		{"not an array", `{"op": "remove", "path": "/a"}`},
+		{"missing value", `[{"op": "add", "path": "/a"}]`},
+		{"invalid value", `[{"op": "add", "path": "/a", "value": [}]`},
+		{"unknown op", `[{"op": "spam", "path": "/a"}]`},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			if _, err := ParsePatch(strings.NewReader(tc.Patch)); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+}
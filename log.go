@@ -0,0 +1,363 @@
+package patchstructure
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Log is a versioned log of patches applied to a base value.
+//
+// Each patch appended to the log is assigned the next version, starting at
+// 1. The base value is version 0 until the log is compacted, at which point
+// the base value becomes a snapshot of a later version and the entries up
+// to that version are discarded.
+//
+// A Log can be serialized in a JSON lines format with WriteTo and read back
+// with ReadLog. The first line is a snapshot of the base value and each
+// following line is an entry. Struct fields are written with the names used
+// to address them in paths (see the package docs on struct tags) rather than
+// their json names, so the operations still apply after reading the log. Since each entry is a single line, entries can
+// be appended to an existing file with LogEntry.WriteTo. Snapshot lines
+// may also be appended to a file after compacting: the last snapshot in
+// a file replaces the base value and all the entries before it.
+//
+// A Log is not safe for concurrent use.
+type Log struct {
+	base        interface{}
+	baseVersion uint64
+	entries     []*LogEntry
+}
+
+// LogEntry is a single versioned patch within a Log.
+type LogEntry struct {
+	Version uint64       `json:"version"`
+	Ops     []*Operation `json:"ops"`
+}
+
+// NewLog returns a new Log with the base value v at version 0. The Log
+// takes ownership of v so it must not be modified after calling this.
+func NewLog(v interface{}) *Log {
+	return &Log{base: v}
+}
+
+// Version returns the latest version of the log.
+func (l *Log) Version() uint64 {
+	return l.baseVersion + uint64(len(l.entries))
+}
+
+// BaseVersion returns the version of the base value of the log. This is
+// zero unless the log has been compacted.
+func (l *Log) BaseVersion() uint64 {
+	return l.baseVersion
+}
+
+// Append appends the operations ops to the log as the next version and
+// returns the new entry. The operations are not validated.
+func (l *Log) Append(ops []*Operation) *LogEntry {
+	entry := &LogEntry{
+		Version: l.Version() + 1,
+		Ops:     ops,
+	}
+
+	l.entries = append(l.entries, entry)
+	return entry
+}
+
+// Value returns the value of the log at the latest version. This is a new
+// value built by applying every entry to a deep copy of the base value.
+func (l *Log) Value() (interface{}, error) {
+	base, err := l.copyBase()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.Replay(base, l.baseVersion)
+}
+
+// Replay applies the entries after version to the value v, which must be
+// the value of the log at that version. For example, a value saved at
+// version 5 is brought up to date with Replay(v, 5). The value v is
+// modified in the same way as Patch.
+//
+// It is an error if version is before the base version since those
+// entries have been compacted.
+func (l *Log) Replay(v interface{}, version uint64) (interface{}, error) {
+	if version < l.baseVersion {
+		return v, fmt.Errorf(
+			"version %d has been compacted, the base version is %d",
+			version, l.baseVersion)
+	}
+	if version > l.Version() {
+		return v, fmt.Errorf(
+			"version %d is newer than the latest version %d",
+			version, l.Version())
+	}
+
+	for _, entry := range l.entries[version-l.baseVersion:] {
+		var err error
+		v, err = Patch(v, entry.Ops)
+		if err != nil {
+			return v, fmt.Errorf("error replaying version %d: %w", entry.Version, err)
+		}
+	}
+
+	return v, nil
+}
+
+// Compact applies the entries up to and including version to the base
+// value and discards them, making the result the new base value.
+func (l *Log) Compact(version uint64) error {
+	if version < l.baseVersion || version > l.Version() {
+		return fmt.Errorf(
+			"version %d must be between the base version %d and the latest version %d",
+			version, l.baseVersion, l.Version())
+	}
+
+	base, err := l.copyBase()
+	if err != nil {
+		return err
+	}
+
+	n := version - l.baseVersion
+	for _, entry := range l.entries[:n] {
+		base, err = Patch(base, entry.Ops)
+		if err != nil {
+			return fmt.Errorf("error compacting version %d: %w", entry.Version, err)
+		}
+	}
+
+	l.base = base
+	l.baseVersion = version
+	l.entries = append([]*LogEntry(nil), l.entries[n:]...)
+	return nil
+}
+
+// copyBase returns a deep copy of the base value so that it can be patched.
+func (l *Log) copyBase() (interface{}, error) {
+	return copyValue(l.base)
+}
+
+// WriteTo writes the log in the JSON lines format: a snapshot of the base
+// value followed by each entry.
+func (l *Log) WriteTo(w io.Writer) (int64, error) {
+	snapshot, err := json.Marshal(logValue(reflect.ValueOf(l.base)))
+	if err != nil {
+		return 0, fmt.Errorf("error encoding base value: %s", err)
+	}
+
+	total, err := writeLogRecord(w, &logRecord{
+		Version:  l.baseVersion,
+		Snapshot: snapshot,
+	})
+	if err != nil {
+		return total, err
+	}
+
+	for _, entry := range l.entries {
+		n, err := entry.WriteTo(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// WriteTo writes the entry as a single line in the JSON lines format
+// used by Log.
+func (e *LogEntry) WriteTo(w io.Writer) (int64, error) {
+	ops := make([]*Operation, len(e.Ops))
+	for i, op := range e.Ops {
+		copy := *op
+		copy.Value = logValue(reflect.ValueOf(op.Value))
+		ops[i] = &copy
+	}
+
+	raw, err := json.Marshal(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	return writeLogRecord(w, &logRecord{
+		Version: e.Version,
+		Ops:     raw,
+	})
+}
+
+// ReadLog reads a log in the JSON lines format written by Log.WriteTo and
+// LogEntry.WriteTo.
+//
+// Numbers are decoded as json.Number, as they are by ParsePatch, so large
+// integers are replayed without loss of precision. If into is nil, the base
+// value is made up of the generic JSON types such as map[string]interface{}.
+// Otherwise the base value is converted to the type of into the same way
+// operations set values, so ReadLog(r, (*T)(nil)) reads the log of a *T.
+func ReadLog(r io.Reader, into interface{}) (*Log, error) {
+	var result *Log
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record logRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		// A snapshot replaces everything before it
+		if record.Snapshot != nil {
+			base, err := readLogSnapshot(record.Snapshot, into)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: error decoding snapshot: %s", line, err)
+			}
+
+			result = &Log{base: base, baseVersion: record.Version}
+			continue
+		}
+
+		if result == nil {
+			return nil, fmt.Errorf("line %d: log must start with a snapshot", line)
+		}
+
+		// Entries before the snapshot are expected if the snapshot was
+		// appended after compacting, so we skip them.
+		if record.Version <= result.Version() {
+			continue
+		}
+		if record.Version != result.Version()+1 {
+			return nil, fmt.Errorf(
+				"line %d: expected version %d, got %d",
+				line, result.Version()+1, record.Version)
+		}
+
+		var ops []*Operation
+		if record.Ops != nil {
+			var err error
+			if ops, err = new(jsonDecoder).patch(record.Ops); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+		}
+
+		result.entries = append(result.entries, &LogEntry{
+			Version: record.Version,
+			Ops:     ops,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, fmt.Errorf("log must start with a snapshot")
+	}
+
+	return result, nil
+}
+
+// readLogSnapshot decodes the snapshot raw and converts it to the type
+// of into, if into isn't nil.
+func readLogSnapshot(raw []byte, into interface{}) (interface{}, error) {
+	base, err := new(jsonDecoder).decode(raw)
+	if err != nil || into == nil {
+		return base, err
+	}
+
+	result, err := coerce(base, reflect.TypeOf(into), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Interface(), nil
+}
+
+// logValue returns the value v with structs converted to maps keyed by the
+// names used in paths, so that it can be encoded for a Log. Values that
+// encode themselves to JSON are left as is.
+func logValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.CanInterface() {
+		switch v.Interface().(type) {
+		case json.Marshaler, encoding.TextMarshaler:
+			return v.Interface()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+
+		return logValue(v.Elem())
+
+	case reflect.Struct:
+		result := make(map[string]interface{})
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := structFieldName(t.Field(i)); ok {
+				result[name] = logValue(v.Field(i))
+			}
+		}
+
+		return result
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		result := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			result[fmt.Sprint(k.Interface())] = logValue(v.MapIndex(k))
+		}
+
+		return result
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+
+		result := make([]interface{}, v.Len())
+		for i := range result {
+			result[i] = logValue(v.Index(i))
+		}
+
+		return result
+	}
+
+	if !v.CanInterface() {
+		return nil
+	}
+
+	return v.Interface()
+}
+
+// logRecord is a single line of a serialized Log. This is either a
+// snapshot or an entry depending on whether Snapshot is set. The
+// operations are kept encoded to decode them the same way as ParsePatch.
+type logRecord struct {
+	Version  uint64          `json:"version"`
+	Snapshot json.RawMessage `json:"snapshot,omitempty"`
+	Ops      json.RawMessage `json:"ops,omitempty"`
+}
+
+// writeLogRecord writes the record as a single line to w.
+func writeLogRecord(w io.Writer, record *logRecord) (int64, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(append(raw, '\n'))
+	return int64(n), err
+}
@@ -0,0 +1,312 @@
+package patchstructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	l := NewLog(map[string]interface{}{"a": 1})
+	l.Append([]*Operation{
+		&Operation{Op: OpAdd, Path: "/b", Value: "foo"},
+	})
+	entry := l.Append([]*Operation{
+		&Operation{Op: OpReplace, Path: "/a", Value: 2},
+	})
+	if entry.Version != 2 || l.Version() != 2 {
+		t.Fatalf("bad: %d %d", entry.Version, l.Version())
+	}
+
+	expected := map[string]interface{}{"a": 2, "b": "foo"}
+	actual, err := l.Value()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Replay from a value at an intermediate version
+	actual, err = l.Replay(map[string]interface{}{"a": 1, "b": "foo"}, 1)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Compacting doesn't change the latest value
+	if err := l.Compact(1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if l.BaseVersion() != 1 || l.Version() != 2 {
+		t.Fatalf("bad: %d %d", l.BaseVersion(), l.Version())
+	}
+	actual, err = l.Value()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Compacted versions can't be replayed
+	if _, err := l.Replay(map[string]interface{}{"a": 1}, 0); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := l.Replay(expected, 3); err == nil {
+		t.Fatal("should error")
+	}
+	if err := l.Compact(0); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestLog_compactError(t *testing.T) {
+	l := NewLog(map[string]interface{}{"a": 1})
+	l.Append([]*Operation{
+		&Operation{Op: OpAdd, Path: "/b", Value: "foo"},
+	})
+	l.Append([]*Operation{
+		&Operation{Op: OpRemove, Path: "/nope"},
+	})
+
+	if err := l.Compact(2); err == nil {
+		t.Fatal("should error")
+	}
+
+	// The log is unchanged after a failed compaction
+	if l.BaseVersion() != 0 || l.Version() != 2 {
+		t.Fatalf("bad: %d %d", l.BaseVersion(), l.Version())
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Input    string
+		Version  uint64
+		Expected interface{}
+		Err      bool
+	}{
+		{
+			"snapshot only",
+			`{"version":0,"snapshot":{"a":1}}`,
+			0,
+			map[string]interface{}{"a": json.Number("1")},
+			false,
+		},
+
+		{
+			"null snapshot",
+			`{"version":0,"snapshot":null}
+{"version":1,"ops":[{"op":"replace","path":"","value":"foo"}]}`,
+			1,
+			"foo",
+			false,
+		},
+
+		{
+			"entries",
+			`{"version":0,"snapshot":{"a":1}}
+{"version":1,"ops":[{"op":"add","path":"/b","value":"foo"}]}
+
+{"version":2,"ops":[{"op":"remove","path":"/a"}]}`,
+			2,
+			map[string]interface{}{"b": "foo"},
+			false,
+		},
+
+		{
+			"appended snapshot",
+			`{"version":0,"snapshot":{"a":1}}
+{"version":1,"ops":[{"op":"add","path":"/b","value":"foo"}]}
+{"version":2,"ops":[{"op":"remove","path":"/a"}]}
+{"version":2,"snapshot":{"b":"foo"}}
+{"version":3,"ops":[{"op":"add","path":"/c","value":"bar"}]}`,
+			3,
+			map[string]interface{}{"b": "foo", "c": "bar"},
+			false,
+		},
+
+		{
+			"no snapshot",
+			`{"version":1,"ops":[{"op":"add","path":"/b","value":"foo"}]}`,
+			0,
+			nil,
+			true,
+		},
+
+		{
+			"empty",
+			``,
+			0,
+			nil,
+			true,
+		},
+
+		{
+			"missing version",
+			`{"version":0,"snapshot":{"a":1}}
+{"version":2,"ops":[{"op":"remove","path":"/a"}]}`,
+			0,
+			nil,
+			true,
+		},
+
+		{
+			"invalid json",
+			`{"version":0,"snapshot":{"a":1}}
+{"version":1,`,
+			0,
+			nil,
+			true,
+		},
+
+		{
+			"unknown op",
+			`{"version":0,"snapshot":{"a":1}}
+{"version":1,"ops":[{"op":"nope","path":"/a"}]}`,
+			0,
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			l, err := ReadLog(strings.NewReader(tc.Input), nil)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if l.Version() != tc.Version {
+				t.Fatalf("bad version: %d", l.Version())
+			}
+
+			actual, err := l.Value()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+func TestLogWriteTo(t *testing.T) {
+	l := NewLog(map[string]interface{}{"a": 1})
+	l.Append([]*Operation{
+		&Operation{Op: OpAdd, Path: "/b", Value: "foo"},
+	})
+	l.Append([]*Operation{
+		&Operation{Op: OpRemove, Path: "/a"},
+	})
+	if err := l.Compact(1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := l.WriteTo(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Append an entry to the end as it would be appended to a file
+	entry := l.Append([]*Operation{
+		&Operation{Op: OpAdd, Path: "/c", Value: "bar"},
+	})
+	if _, err := entry.WriteTo(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := ReadLog(&buf, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual.BaseVersion() != 1 || actual.Version() != 3 {
+		t.Fatalf("bad: %d %d", actual.BaseVersion(), actual.Version())
+	}
+
+	value, err := actual.Value()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := map[string]interface{}{"b": "foo", "c": "bar"}
+	if !reflect.DeepEqual(value, expected) {
+		t.Fatalf("bad: %#v", value)
+	}
+}
+
+func TestLogWriteTo_typed(t *testing.T) {
+	type testItem struct {
+		ID int64 `patchstructure:"id" json:"item_id"`
+	}
+
+	type testStruct struct {
+		Name  string              `patchstructure:"name" json:"full_name"`
+		Items []testItem          `patchstructure:"items"`
+		Extra map[string]testItem `patchstructure:"extra"`
+	}
+
+	l := NewLog(&testStruct{Name: "foo", Extra: map[string]testItem{}})
+	l.Append([]*Operation{
+		&Operation{Op: OpReplace, Path: "/name", Value: "bar"},
+		&Operation{Op: OpAdd, Path: "/items/-", Value: testItem{ID: 9007199254740993}},
+	})
+	if err := l.Compact(1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	l.Append([]*Operation{
+		&Operation{Op: OpAdd, Path: "/extra/a", Value: map[string]interface{}{"id": int64(1<<62 + 1)}},
+		&Operation{Op: OpReplace, Path: "/items/0/id", Value: int64(9007199254740995)},
+	})
+
+	expected, err := l.Value()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := l.WriteTo(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	raw := buf.String()
+
+	// The log is read back into the original type
+	actual, err := ReadLog(strings.NewReader(raw), (*testStruct)(nil))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	value, err := actual.Value()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Fatalf("bad: %#v\n\nexpected: %#v", value, expected)
+	}
+
+	// The log also replays without a type and keeps large numbers exact
+	actual, err = ReadLog(strings.NewReader(raw), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	value, err = actual.Value()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	items := value.(map[string]interface{})["items"].([]interface{})
+	if n := items[0].(map[string]interface{})["id"]; n != json.Number("9007199254740995") {
+		t.Fatalf("bad: %#v", n)
+	}
+	extra := value.(map[string]interface{})["extra"].(map[string]interface{})
+	if n := extra["a"].(map[string]interface{})["id"]; n != json.Number("4611686018427387905") {
+		t.Fatalf("bad: %#v", n)
+	}
+}
@@ -0,0 +1,195 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// MergePatch applies the JSON Merge Patch (RFC 7396) document patch to
+// the value v.
+//
+// The patch document is typically a map[string]interface{} decoded from
+// JSON. Nil values remove the member from the target, maps are merged
+// recursively into maps and structs, and any other value replaces the
+// target member. Struct fields are addressed the same way as they are
+// for paths and "removing" a struct field sets it to its zero value.
+//
+// This is equivalent to calling Patch with the result of
+// MergePatchOperations and has the same error semantics as Patch: errors
+// are always a *PatchError. A member that can't be merged, such as an
+// unknown struct field, is an error for the operation that would have
+// merged it.
+func MergePatch(v, patch interface{}) (interface{}, error) {
+	ops, err := MergePatchOperations(v, patch)
+	if err != nil {
+		return v, err
+	}
+
+	return Patch(v, ops)
+}
+
+// MergePatchOperations returns the operations that are equivalent to
+// applying the JSON Merge Patch (RFC 7396) document patch to the value v.
+//
+// The value v is required since a merge patch depends on the target: for
+// example, removing a member that doesn't exist is not an error in a merge
+// patch but it is an error for a "remove" operation. The value v is
+// not modified. Errors are a *PatchError, as they are for MergePatch.
+func MergePatchOperations(v, patch interface{}) ([]*Operation, error) {
+	var ops []*Operation
+	if err := mergeOps(&ops, nil, reflect.ValueOf(v), patch); err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// mergeOps appends the operations to merge patch into target, located at
+// the path parts, to ops.
+func mergeOps(ops *[]*Operation, parts []string, target reflect.Value, patch interface{}) error {
+	// "If the provided merge patch contains members that are not objects
+	// (or if it is not an object), the result is the merge patch itself."
+	patchVal := reflect.ValueOf(patch)
+	if patchVal.Kind() != reflect.Map {
+		*ops = append(*ops, &Operation{
+			Op:    OpReplace,
+			Path:  diffPath(parts),
+			Value: patch,
+		})
+
+		return nil
+	}
+
+	// "If the Target is not an object, the Target is replaced with an
+	// empty object" before merging, which is the patch without nulls.
+	target = mergeTarget(target)
+	if !target.IsValid() {
+		*ops = append(*ops, &Operation{
+			Op:    OpReplace,
+			Path:  diffPath(parts),
+			Value: mergeClean(patch),
+		})
+
+		return nil
+	}
+
+	// Sort the keys so that the resulting operations are deterministic
+	keys := make(map[string]reflect.Value)
+	for _, k := range patchVal.MapKeys() {
+		keys[fmt.Sprint(k.Interface())] = k
+	}
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := diffAppend(parts, name)
+		value := patchVal.MapIndex(keys[name]).Interface()
+
+		// Find the current value of the member in the target. This is
+		// invalid if the member doesn't exist.
+		current, err := mergeMember(target, name)
+		if err != nil {
+			// The error is for the operation that would merge the member,
+			// the same as if that operation failed in Patch.
+			op := &Operation{Op: OpAdd, Path: diffPath(path)}
+			if value == nil {
+				op.Op = OpRemove
+			}
+
+			perr := op.error(err).(*PatchError)
+			perr.Index = len(*ops)
+			return perr
+		}
+
+		switch {
+		case value == nil:
+			// "null" removes the member if it exists
+			if current.IsValid() {
+				*ops = append(*ops, &Operation{
+					Op:   OpRemove,
+					Path: diffPath(path),
+				})
+			}
+
+		case reflect.ValueOf(value).Kind() == reflect.Map && current.IsValid():
+			if err := mergeOps(ops, path, current, value); err != nil {
+				return err
+			}
+
+		default:
+			*ops = append(*ops, &Operation{
+				Op:    OpAdd,
+				Path:  diffPath(path),
+				Value: mergeClean(value),
+			})
+		}
+	}
+
+	return nil
+}
+
+// mergeMember returns the member name of the target, which is a map or
+// a struct. The result is invalid if a map doesn't have the member.
+func mergeMember(target reflect.Value, name string) (reflect.Value, error) {
+	if target.Kind() == reflect.Struct {
+		return structField(target, name)
+	}
+
+	key, err := mapKey(name, target.Type().Key())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return target.MapIndex(key), nil
+}
+
+// mergeTarget dereferences the target value so that it can be merged. If
+// the target isn't an object (a map or a struct) this returns an invalid
+// value. Nil maps and nil pointers to structs are treated as empty since
+// they are allocated when setting a value within them.
+func mergeTarget(v reflect.Value) reflect.Value {
+	v = indirect(v, false)
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.MakeMap(v.Type())
+		}
+
+		return v
+
+	case reflect.Struct:
+		return v
+
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			return reflect.New(v.Type().Elem()).Elem()
+		}
+	}
+
+	return reflect.Value{}
+}
+
+// mergeClean returns the value v with all the nil members of maps removed.
+// This is the result of merging v into an empty object.
+func mergeClean(v interface{}) interface{} {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Map {
+		return v
+	}
+
+	result := make(map[string]interface{})
+	for _, k := range val.MapKeys() {
+		elem := val.MapIndex(k).Interface()
+		if elem == nil {
+			continue
+		}
+
+		result[fmt.Sprint(k.Interface())] = mergeClean(elem)
+	}
+
+	return result
+}
@@ -0,0 +1,195 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// Conflict is a change made differently by both sides of a three-way merge.
+type Conflict struct {
+	// Path is the path where the changes overlap. If one change is within
+	// the value changed by the other, this is the path of the outer change.
+	// If the changes are to the same slice by index, this is its path.
+	Path string
+
+	Ours   *Operation // Ours is the change from ours
+	Theirs *Operation // Theirs is the change from theirs
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf(
+		"conflict at %q: ours %s %q, theirs %s %q",
+		c.Path, c.Ours.Op, c.Ours.Path, c.Theirs.Op, c.Theirs.Path)
+}
+
+// Merge3 performs a three-way merge of the values ours and theirs, which
+// were both changed from the value base. The result is a patch that
+// applies the changes from both sides to base.
+//
+// The changes on each side are found with Diff, so they are made at the
+// same paths as Diff. Changes that both sides made identically are only
+// applied once. Changes that overlap, such as both sides changing the same
+// value differently or one side removing a value that the other changed,
+// are returned as conflicts and aren't part of the patch: the value at
+// the conflicting path is left as it is in base.
+//
+// Slices are diffed by index, so an index doesn't identify the same element
+// once either side has inserted or removed elements. Any changes that both
+// sides make within the same slice of base by index are conflicts, with
+// the path of the slice, unless they're identical. The options opts are
+// passed to Diff, so WithSliceKey can be used to merge the elements of
+// slices by key instead.
+func Merge3(base, ours, theirs interface{}, opts ...DiffOption) ([]*Operation, []Conflict, error) {
+	oursOps, err := Diff(base, ours, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	theirsOps, err := Diff(base, theirs, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oursPaths, oursSlices, err := merge3Paths(base, oursOps)
+	if err != nil {
+		return nil, nil, err
+	}
+	theirsPaths, theirsSlices, err := merge3Paths(base, theirsOps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Find every overlapping pair of changes. Identical changes are
+	// skipped from theirs since they're already in ours.
+	var conflicts []Conflict
+	oursConflict := make([]bool, len(oursOps))
+	theirsSkip := make([]bool, len(theirsOps))
+	for i, a := range oursOps {
+		for j, b := range theirsOps {
+			pa, pb := oursPaths[i], theirsPaths[j]
+			slice, shared := merge3Shared(oursSlices[i], theirsSlices[j])
+			if !shared && !otPrefix(pa, pb) && !otPrefix(pb, pa) {
+				continue
+			}
+
+			if merge3Equal(a, b) {
+				theirsSkip[j] = true
+				continue
+			}
+
+			path := a.Path
+			if len(pb) < len(pa) {
+				path = b.Path
+			}
+			if shared && !otPrefix(pa, pb) && !otPrefix(pb, pa) {
+				path = slice
+			}
+
+			conflicts = append(conflicts, Conflict{
+				Path:   path,
+				Ours:   a,
+				Theirs: b,
+			})
+
+			oursConflict[i] = true
+			theirsSkip[j] = true
+		}
+	}
+
+	var result []*Operation
+	for i, op := range oursOps {
+		if !oursConflict[i] {
+			result = append(result, op)
+		}
+	}
+	for j, op := range theirsOps {
+		if !theirsSkip[j] {
+			result = append(result, op)
+		}
+	}
+
+	return result, conflicts, nil
+}
+
+// merge3Paths parses the paths of the operations and finds the slices of
+// base that each operation addresses by index, as paths to the slices.
+func merge3Paths(base interface{}, ops []*Operation) ([][]string, [][]string, error) {
+	paths := make([][]string, len(ops))
+	slices := make([][]string, len(ops))
+	for i, op := range ops {
+		p, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		steps := make([]globStep, len(p.Parts))
+		for j, part := range p.Parts {
+			steps[j] = globStep{name: part}
+		}
+		if op.Glob {
+			if steps, err = parseGlob(op.Path); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		paths[i] = p.Parts
+		slices[i] = merge3Slices(base, steps)
+	}
+
+	return paths, slices, nil
+}
+
+// merge3Slices returns the paths of the slices in v that the path steps
+// address by index. A filter selector addresses an element by its value
+// rather than its index.
+func merge3Slices(v interface{}, steps []globStep) []string {
+	var result []string
+	var prefix []string
+	current := reflect.ValueOf(v)
+	for _, step := range steps {
+		current = indirect(current, false)
+		if step.filter == nil && current.Kind() == reflect.Slice {
+			result = append(result, (&pointerstructure.Pointer{Parts: prefix}).String())
+		}
+
+		found := false
+		for _, child := range globChildren(current) {
+			if step.filter != nil && step.filter.match(child.value) ||
+				step.filter == nil && child.name == step.name {
+				prefix = globAppend(prefix, child.name)
+				current = child.value
+				found = true
+				break
+			}
+		}
+
+		// The rest of the path is new so there are no more slices in v
+		if !found {
+			break
+		}
+	}
+
+	return result
+}
+
+// merge3Shared returns the first slice path that is in both a and b.
+func merge3Shared(a, b []string) (string, bool) {
+	for _, pa := range a {
+		for _, pb := range b {
+			if pa == pb {
+				return pa, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// merge3Equal returns true if the operations make the same change.
+func merge3Equal(a, b *Operation) bool {
+	return a.Op == b.Op &&
+		a.Path == b.Path &&
+		a.From == b.From &&
+		reflect.DeepEqual(a.Value, b.Value)
+}
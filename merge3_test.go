@@ -0,0 +1,273 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/copystructure"
+)
+
+func TestMerge3(t *testing.T) {
+	type testConfig struct {
+		Name    string            `json:"name"`
+		Port    int               `json:"port"`
+		Labels  map[string]string `json:"labels"`
+		Servers []string          `json:"servers"`
+	}
+
+	cases := []struct {
+		Name      string
+		Base      interface{}
+		Ours      interface{}
+		Theirs    interface{}
+		Expected  interface{}
+		Conflicts []string
+	}{
+		{
+			"no changes",
+			map[string]interface{}{"a": 1},
+			map[string]interface{}{"a": 1},
+			map[string]interface{}{"a": 1},
+			map[string]interface{}{"a": 1},
+			nil,
+		},
+
+		{
+			"different keys",
+			map[string]interface{}{"a": 1, "b": 2, "c": 3},
+			map[string]interface{}{"a": 10, "b": 2, "c": 3},
+			map[string]interface{}{"a": 1, "c": 3, "d": 4},
+			map[string]interface{}{"a": 10, "c": 3, "d": 4},
+			nil,
+		},
+
+		{
+			"same change",
+			map[string]interface{}{"a": 1},
+			map[string]interface{}{"a": 2},
+			map[string]interface{}{"a": 2},
+			map[string]interface{}{"a": 2},
+			nil,
+		},
+
+		{
+			"same remove",
+			map[string]interface{}{"a": 1, "b": 2},
+			map[string]interface{}{"b": 2},
+			map[string]interface{}{"b": 2},
+			map[string]interface{}{"b": 2},
+			nil,
+		},
+
+		{
+			"modified differently",
+			map[string]interface{}{"a": 1, "b": 2},
+			map[string]interface{}{"a": 2, "b": 3},
+			map[string]interface{}{"a": 3, "b": 2},
+			map[string]interface{}{"a": 1, "b": 3},
+			[]string{"/a"},
+		},
+
+		{
+			"remove and modify",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			map[string]interface{}{},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 2},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]string{"/a"},
+		},
+
+		{
+			"nested changes",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1, "c": 1},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 2, "c": 1},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1, "c": 2},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 2, "c": 2},
+			},
+			nil,
+		},
+
+		{
+			"slice elements",
+			[]interface{}{1, 2, 3},
+			[]interface{}{10, 2, 3},
+			[]interface{}{1, 2, 3, 4},
+			[]interface{}{1, 2, 3},
+			[]string{""},
+		},
+
+		{
+			"slice removed differently",
+			map[string]interface{}{"l": []interface{}{"a", "b", "c"}},
+			map[string]interface{}{"l": []interface{}{"a", "b"}},
+			map[string]interface{}{"l": []interface{}{"a", "c"}},
+			map[string]interface{}{"l": []interface{}{"a", "b", "c"}},
+			[]string{"/l"},
+		},
+
+		{
+			"different slices",
+			map[string]interface{}{"a": []interface{}{1}, "b": []interface{}{2}},
+			map[string]interface{}{"a": []interface{}{}, "b": []interface{}{2}},
+			map[string]interface{}{"a": []interface{}{1}, "b": []interface{}{2, 3}},
+			map[string]interface{}{"a": []interface{}{}, "b": []interface{}{2, 3}},
+			nil,
+		},
+
+		{
+			"slice appended differently",
+			[]interface{}{1},
+			[]interface{}{1, 2},
+			[]interface{}{1, 3},
+			[]interface{}{1},
+			[]string{"/-"},
+		},
+
+		{
+			"struct",
+			&testConfig{
+				Name:    "foo",
+				Port:    80,
+				Labels:  map[string]string{"env": "dev"},
+				Servers: []string{"a", "b"},
+			},
+			&testConfig{
+				Name:    "bar",
+				Port:    80,
+				Labels:  map[string]string{"env": "dev", "team": "web"},
+				Servers: []string{"a", "c"},
+			},
+			&testConfig{
+				Name:    "foo",
+				Port:    8080,
+				Labels:  map[string]string{"env": "prod"},
+				Servers: []string{"a", "d"},
+			},
+			&testConfig{
+				Name:    "bar",
+				Port:    8080,
+				Labels:  map[string]string{"env": "prod", "team": "web"},
+				Servers: []string{"a", "b"},
+			},
+			[]string{"/servers/1"},
+		},
+
+		{
+			"replaced with different type",
+			map[string]interface{}{"a": 1},
+			"foo",
+			map[string]interface{}{"a": 2},
+			map[string]interface{}{"a": 1},
+			[]string{""},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			ops, conflicts, err := Merge3(tc.Base, tc.Ours, tc.Theirs)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			var paths []string
+			for _, c := range conflicts {
+				paths = append(paths, c.Path)
+			}
+			if !reflect.DeepEqual(paths, tc.Conflicts) {
+				t.Fatalf("bad conflicts: %#v", conflicts)
+			}
+
+			base, err := copystructure.Copy(tc.Base)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			actual, err := Patch(base, ops)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+func TestMerge3_conflict(t *testing.T) {
+	_, conflicts, err := Merge3(
+		map[string]interface{}{"a": map[string]interface{}{"b": 1}},
+		map[string]interface{}{"a": "foo"},
+		map[string]interface{}{"a": map[string]interface{}{}},
+	)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []Conflict{
+		{
+			Path:   "/a",
+			Ours:   &Operation{Op: OpReplace, Path: "/a", Value: "foo"},
+			Theirs: &Operation{Op: OpRemove, Path: "/a/b"},
+		},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Fatalf("bad: %#v", conflicts)
+	}
+
+	str := `conflict at "/a": ours replace "/a", theirs remove "/a/b"`
+	if actual := conflicts[0].String(); actual != str {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestMerge3_sliceKey(t *testing.T) {
+	base := []interface{}{
+		map[string]interface{}{"id": "a", "v": 1},
+		map[string]interface{}{"id": "b", "v": 2},
+		map[string]interface{}{"id": "c", "v": 3},
+	}
+	ours := []interface{}{
+		map[string]interface{}{"id": "a", "v": 1},
+		map[string]interface{}{"id": "c", "v": 3},
+	}
+	theirs := []interface{}{
+		map[string]interface{}{"id": "a", "v": 1},
+		map[string]interface{}{"id": "b", "v": 2},
+		map[string]interface{}{"id": "c", "v": 30},
+	}
+
+	ops, conflicts, err := Merge3(base, ours, theirs, WithSliceKey("", "id"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(conflicts) > 0 {
+		t.Fatalf("bad: %#v", conflicts)
+	}
+
+	actual, err := Patch(base, ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{"id": "a", "v": 1},
+		map[string]interface{}{"id": "c", "v": 30},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
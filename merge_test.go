@@ -0,0 +1,251 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	type testInner struct {
+		Value int
+	}
+
+	type testStruct struct {
+		Name   string            `json:"name"`
+		Inner  *testInner        `json:"inner"`
+		Labels map[string]string `json:"labels"`
+	}
+
+	cases := []struct {
+		Name     string
+		Input    interface{}
+		Patch    interface{}
+		Expected interface{}
+		Err      bool
+	}{
+		// The examples from RFC 7396 Appendix A
+		{
+			"rfc: replace member",
+			map[string]interface{}{"a": "b"},
+			map[string]interface{}{"a": "c"},
+			map[string]interface{}{"a": "c"},
+			false,
+		},
+
+		{
+			"rfc: add member",
+			map[string]interface{}{"a": "b"},
+			map[string]interface{}{"b": "c"},
+			map[string]interface{}{"a": "b", "b": "c"},
+			false,
+		},
+
+		{
+			"rfc: remove member",
+			map[string]interface{}{"a": "b"},
+			map[string]interface{}{"a": nil},
+			map[string]interface{}{},
+			false,
+		},
+
+		{
+			"rfc: remove one member",
+			map[string]interface{}{"a": "b", "b": "c"},
+			map[string]interface{}{"a": nil},
+			map[string]interface{}{"b": "c"},
+			false,
+		},
+
+		{
+			"rfc: replace array",
+			map[string]interface{}{"a": []interface{}{"b"}},
+			map[string]interface{}{"a": "c"},
+			map[string]interface{}{"a": "c"},
+			false,
+		},
+
+		{
+			"rfc: replace with array",
+			map[string]interface{}{"a": "c"},
+			map[string]interface{}{"a": []interface{}{"b"}},
+			map[string]interface{}{"a": []interface{}{"b"}},
+			false,
+		},
+
+		{
+			"rfc: nested",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": "c"},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": "d", "c": nil},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": "d"},
+			},
+			false,
+		},
+
+		{
+			"rfc: replace array of objects",
+			map[string]interface{}{
+				"a": []interface{}{map[string]interface{}{"b": "c"}},
+			},
+			map[string]interface{}{"a": []interface{}{1}},
+			map[string]interface{}{"a": []interface{}{1}},
+			false,
+		},
+
+		{
+			"rfc: replace object with array",
+			map[string]interface{}{"a": "foo"},
+			[]interface{}{"bar"},
+			[]interface{}{"bar"},
+			false,
+		},
+
+		{
+			"rfc: replace with null",
+			map[string]interface{}{"a": "foo"},
+			nil,
+			nil,
+			false,
+		},
+
+		{
+			"rfc: replace non-object",
+			map[string]interface{}{"e": nil},
+			map[string]interface{}{"a": 1},
+			map[string]interface{}{"e": nil, "a": 1},
+			false,
+		},
+
+		{
+			"rfc: replace array with object",
+			[]interface{}{1, 2},
+			map[string]interface{}{"a": "b", "c": nil},
+			map[string]interface{}{"a": "b"},
+			false,
+		},
+
+		{
+			"rfc: deep null",
+			map[string]interface{}{},
+			map[string]interface{}{
+				"a": map[string]interface{}{
+					"bb": map[string]interface{}{"ccc": nil},
+				},
+			},
+			map[string]interface{}{
+				"a": map[string]interface{}{
+					"bb": map[string]interface{}{},
+				},
+			},
+			false,
+		},
+
+		{
+			"struct",
+			&testStruct{Name: "foo", Labels: map[string]string{"a": "b"}},
+			map[string]interface{}{
+				"name":   nil,
+				"inner":  map[string]interface{}{"Value": 42},
+				"labels": map[string]interface{}{"a": nil, "c": "d"},
+			},
+			&testStruct{
+				Inner:  &testInner{Value: 42},
+				Labels: map[string]string{"c": "d"},
+			},
+			false,
+		},
+
+		{
+			"struct nil map",
+			&testStruct{},
+			map[string]interface{}{
+				"labels": map[string]interface{}{"c": "d"},
+			},
+			&testStruct{
+				Labels: map[string]string{"c": "d"},
+			},
+			false,
+		},
+
+		{
+			"struct unknown field",
+			&testStruct{},
+			map[string]interface{}{"nope": 42},
+			nil,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := MergePatch(tc.Input, tc.Patch)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+func TestMergePatchOperations(t *testing.T) {
+	input := map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": "e"},
+	}
+
+	actual, err := MergePatchOperations(input, map[string]interface{}{
+		"a": nil,
+		"c": map[string]interface{}{"d": "f", "g": nil},
+		"h": map[string]interface{}{"i": nil, "j": 1},
+		"k": nil,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []*Operation{
+		&Operation{Op: OpRemove, Path: "/a"},
+		&Operation{Op: OpAdd, Path: "/c/d", Value: "f"},
+		&Operation{Op: OpAdd, Path: "/h", Value: map[string]interface{}{"j": 1}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestMergePatch_error(t *testing.T) {
+	type testStruct struct {
+		Name  string `json:"name"`
+		Inner struct {
+			Value int `json:"value"`
+		} `json:"inner"`
+	}
+
+	_, err := MergePatch(&testStruct{}, map[string]interface{}{
+		"name":  "foo",
+		"inner": map[string]interface{}{"zz": nil},
+	})
+
+	var perr *PatchError
+	if !errors.As(err, &perr) {
+		t.Fatalf("not a PatchError: %#v", err)
+	}
+	if perr.Index != 0 || perr.Op != OpRemove || perr.Path != "/inner/zz" {
+		t.Fatalf("bad: %#v", perr)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bad: %s", err)
+	}
+}
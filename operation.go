@@ -3,6 +3,7 @@ package patchstructure
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 )
 
 // Operation represents a single operation to apply to a structure.
@@ -10,12 +11,39 @@ import (
 // Note that Value and From are dependent on the operation. Please see
 // the JSON patch documentation for details on this since the semantics for
 // the Go patch is identical.
+//
+// When Value is set into a typed location it is converted the way it would
+// be decoded from JSON. For example, a float64 may be set into an int field
+// and a map[string]interface{} into a struct. This lets operations decoded
+// from JSON patch typed Go structures. By default these conversions may lose
+// information, such as 1.5 becoming 1, unless Strict is set. Decode patches
+// with ParsePatch to keep numbers as json.Number so large integers are set
+// exactly.
+//
+// If Glob is set then Path may contain wildcards: a "*" part matches any
+// single member, field, or element and a "**" part matches zero or more
+// levels of them. The operation is applied to every matching path of the
+// value, so "/users/*/active" addresses the "active" member of every user.
+// Only paths that exist match, except that the last part of the path of
+// an "add", "move", or "copy" may be new. From isn't expanded. Matches are
+// applied in reverse order so removing slice elements doesn't shift the
+// later matches, and an operation with no matches does nothing. A part may
+// end with a filter selector to match by value instead of by position, so
+// "/items[?(@.id=="42")]/qty" addresses the "qty" of the items whose "id"
+// is "42" wherever they are in the slice.
+//
+// In addition to the RFC operations, OpIncrement ("inc") adds the number
+// Value to the number at Path. The result keeps the Go type of the number
+// at Path and it is an error if the result overflows that type or if Value
+// isn't a whole number when Path is an integer.
 type Operation struct {
 	Op      Op          `json:"op"`      // Op is the operation type to apply
 	Path    string      `json:"path"`    // Path is required
 	Value   interface{} `json:"value"`   // Optional depending on op
 	From    string      `json:"from"`    // Optional depending on op
 	Shallow bool        `json:"shallow"` // If true, OpCopy will not deep copy the value
+	Strict  bool        `json:"strict"`  // If true, lossy conversions of Value are an error
+	Glob    bool        `json:"glob"`    // If true, Path may contain wildcards
 }
 
 // Op is an enum representing the supported operations for a patch.
@@ -32,10 +60,13 @@ const (
 	OpMove
 	OpCopy
 	OpTest
+	OpIncrement // Not in RFC6902, see the Operation docs
 )
 
 // String format of an operation matching what it should be if JSON encoded.
 func (o Op) String() string {
+	opLock.RLock()
+	defer opLock.RUnlock()
 	return opString[o]
 }
 
@@ -51,6 +82,8 @@ func (o *Op) UnmarshalJSON(raw []byte) error {
 		return err
 	}
 
+	opLock.RLock()
+	defer opLock.RUnlock()
 	for k, v := range opString {
 		if v == expected {
 			*o = k
@@ -61,49 +94,158 @@ func (o *Op) UnmarshalJSON(raw []byte) error {
 	return fmt.Errorf("unsupported op type: %s", string(raw))
 }
 
+// json.Unmarshaler
+//
+// This decodes the operation and checks that the members that are required
+// for the op are present. A missing "value" would otherwise be the same as
+// a null value.
+func (o *Operation) UnmarshalJSON(raw []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return err
+	}
+
+	// Decode with a type that doesn't have this method to avoid recursion
+	type operation Operation
+	if err := json.Unmarshal(raw, (*operation)(o)); err != nil {
+		return err
+	}
+
+	var required []string
+	switch o.Op {
+	case OpAdd, OpReplace, OpTest, OpIncrement:
+		required = []string{"path", "value"}
+	case OpMove, OpCopy:
+		required = []string{"path", "from"}
+	case OpRemove:
+		required = []string{"path"}
+	}
+
+	for _, name := range required {
+		member, ok := members[name]
+		if !ok || (name != "value" && string(member) == "null") {
+			return fmt.Errorf("%q operation is missing %q", o.Op, name)
+		}
+	}
+
+	return nil
+}
+
 // Apply performs the operation on the value v. The value v will be modified.
 // In the case of an error, v may still be modified. If you wish to protect
 // against partial failure, please deep copy the object prior to changes.
+//
+// Errors returned by Apply are always a *PatchError. For an operation with
+// Glob set, the error has the Path of the match that failed.
 func (o *Operation) Apply(v interface{}) (interface{}, error) {
+	if o.Glob {
+		ops, err := o.expand(v)
+		if err != nil {
+			return v, o.error(err)
+		}
+
+		for _, op := range ops {
+			if v, err = op.Apply(v); err != nil {
+				return v, err
+			}
+		}
+
+		return v, nil
+	}
+
+	opLock.RLock()
 	f, ok := opApplyMap[o.Op]
+	opLock.RUnlock()
 	if !ok {
-		return v, fmt.Errorf("unknown operation: %s", o.Op)
+		return v, o.error(ErrUnknownOp)
 	}
 
 	result, err := f(o, v)
 	if err != nil {
-		return result, fmt.Errorf("error applying operation %s: %s", o.Op, err)
+		return result, o.error(err)
 	}
 
 	return result, nil
 }
 
+// error wraps the error err as a *PatchError for this operation.
+func (o *Operation) error(err error) error {
+	return &PatchError{
+		Index: -1,
+		Op:    o.Op,
+		Path:  o.Path,
+		From:  o.From,
+		Cause: err,
+	}
+}
+
+// RegisterOp registers a custom operation with the given name and returns
+// the Op to use for it. The name is the string representation of the Op,
+// so operations with the name can be JSON encoded and decoded.
+//
+// The function fn is called to apply the operation. It receives the
+// operation and the value to apply it to, and returns the resulting value.
+// The semantics of the fields of Operation are up to fn. Custom operations
+// can be implemented in terms of the built-in operations by applying them
+// from within fn.
+//
+// RegisterOp is typically called from init. It panics if the name is
+// already registered or if fn is nil.
+func RegisterOp(name string, fn ApplyFunc) Op {
+	if fn == nil {
+		panic("patchstructure: RegisterOp fn is nil")
+	}
+
+	opLock.Lock()
+	defer opLock.Unlock()
+	for _, v := range opString {
+		if v == name {
+			panic("patchstructure: RegisterOp called twice for op " + name)
+		}
+	}
+
+	opNext++
+	opString[opNext] = name
+	opApplyMap[opNext] = fn
+	return opNext
+}
+
+// opLock protects the maps below since operations can be registered
+// at runtime with RegisterOp.
+var opLock sync.RWMutex
+
+// opNext is the last Op value that was assigned. RegisterOp increments
+// this for each new operation so this starts as the last built-in Op.
+var opNext = OpIncrement
+
 var opString = map[Op]string{
-	OpInvalid: "invalid",
-	OpAdd:     "add",
-	OpRemove:  "remove",
-	OpReplace: "replace",
-	OpMove:    "move",
-	OpCopy:    "copy",
-	OpTest:    "test",
+	OpInvalid:   "invalid",
+	OpAdd:       "add",
+	OpRemove:    "remove",
+	OpReplace:   "replace",
+	OpMove:      "move",
+	OpCopy:      "copy",
+	OpTest:      "test",
+	OpIncrement: "inc",
 }
 
-// onApplyFunc is the type used internally for applying operations.
-type opApplyFunc func(*Operation, interface{}) (interface{}, error)
+// ApplyFunc is the function type used for applying operations.
+type ApplyFunc func(*Operation, interface{}) (interface{}, error)
 
 // onApplyMap is the map used for lookup for the action to perform
 // when applying an operation.
-var opApplyMap map[Op]opApplyFunc
+var opApplyMap map[Op]ApplyFunc
 
 func init() {
 	// We can't initialize this inline above since it causes an
 	// "initialization loop" error on the compiler.
-	opApplyMap = map[Op]opApplyFunc{
-		OpAdd:     opAdd,
-		OpRemove:  opRemove,
-		OpReplace: opReplace,
-		OpMove:    opMove,
-		OpCopy:    opCopy,
-		OpTest:    opTest,
+	opApplyMap = map[Op]ApplyFunc{
+		OpAdd:       opAdd,
+		OpRemove:    opRemove,
+		OpReplace:   opReplace,
+		OpMove:      opMove,
+		OpCopy:      opCopy,
+		OpTest:      opTest,
+		OpIncrement: opIncrement,
 	}
 }
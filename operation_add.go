@@ -3,7 +3,6 @@ package patchstructure
 import (
 	"fmt"
 	"reflect"
-	"strconv"
 
 	"github.com/mitchellh/pointerstructure"
 )
@@ -11,43 +10,65 @@ import (
 // RFC6902 4.1
 func opAdd(op *Operation, v interface{}) (interface{}, error) {
 	// Parse the path
-	pointer, err := pointerstructure.Parse(op.Path)
+	pointer, err := parsePointer(op.Path)
 	if err != nil {
 		return v, err
 	}
 
+	// Read-only struct fields can't be changed
+	if err := readOnly(OpAdd, pointer, v, op.Value); err != nil {
+		return v, err
+	}
+
 	// If the pointer is root, then we apply directly to it since it'll
 	// replace the entire doc. RFC quote below.
 	if pointer.IsRoot() {
 		// "The root of the target document - whereupon the specified value
 		//  becomes the entire content of the target document."
-		return pointer.Set(v, op.Value)
+		return setValue(pointer, v, op.Value, op.Strict)
 	}
 
 	// Get the path that we want to add to (the parent)
-	parent, err := pointer.Parent().Get(v)
+	parentVal, err := lookup(pointer.Parent(), v, false)
 	if err != nil {
 		return v, err
 	}
+	parentVal = indirect(parentVal, false)
+
+	// The type will determine how we handle this. A nil pointer to a
+	// struct is allocated when we set into it so we treat it as a struct.
+	kind := parentVal.Kind()
+	if kind == reflect.Ptr {
+		kind = parentVal.Type().Elem().Kind()
+	}
 
-	// The type will determine how we handle this
-	parentVal := reflect.ValueOf(parent)
-	switch parentVal.Kind() {
+	switch kind {
 	case reflect.Map:
 		// "If the target location specifies an object member that does not
 		// already exist, a new member is added to the object."
 		//
 		// "If the target location specifies an object member that does exist,
 		// that member's value is replaced."
-		return pointer.Set(v, op.Value)
+		return setValue(pointer, v, op.Value, op.Strict)
+
+	case reflect.Struct:
+		// Struct fields always exist so adding is the same as setting the
+		// field. This follows the same semantics as maps above.
+		return setValue(pointer, v, op.Value, op.Strict)
 
 	case reflect.Slice:
 		return opAddSlice(pointer, parentVal, op, v)
 
+	case reflect.Array:
+		// Arrays have a fixed length so elements can't be inserted. Instead,
+		// adding to an array index overwrites the element at that index and
+		// "-" is an error since it can't be appended to.
+		return setValue(pointer, v, op.Value, op.Strict)
+
 	default:
 		return v, fmt.Errorf(
-			"can only add to maps, slices, arrays, or structs, got %q",
-			parentVal.Kind())
+			"%w: can only add to maps, slices, arrays, or structs, got %q",
+			ErrTypeMismatch, parentVal.Kind())
 	}
 }
 
@@ -60,7 +81,7 @@ func opAddSlice(
 	// pointerstructure will handle the append.
 	endPart := p.Parts[len(p.Parts)-1]
 	if endPart == "-" {
-		return p.Set(v, op.Value)
+		return setValue(p, v, op.Value, op.Strict)
 	}
 
 	// "An element to add to an existing array - whereupon the supplied
@@ -76,18 +97,17 @@ func opAddSlice(
 	// s[i] = x
 
 	// First step: convert the part to an int so we can determine what index
-	idxRaw, err := strconv.ParseInt(endPart, 10, 0)
+	idx, err := parseIndex(endPart)
 	if err != nil {
-		return v, fmt.Errorf("error parsing index %q: %s", endPart, err)
+		return v, err
 	}
-	idx := int(idxRaw)
 
 	// "The specified index MUST NOT be greater than the
 	// number of elements in the array"
-	if idx >= parentVal.Len() {
+	if idx > parentVal.Len() {
 		return v, fmt.Errorf(
-			"index %d is greater than the length %d",
-			idx, parentVal.Len())
+			"%w: index %d is greater than the length %d",
+			ErrInvalidIndex, idx, parentVal.Len())
 	}
 
 	// Create a zero value to append for: s = append(s, 0)
@@ -100,11 +120,11 @@ func opAddSlice(
 		slice.Slice(idx, slice.Len()))
 
 	// Set the parent so that the slice is overwritten
-	v, err = p.Parent().Set(v, slice.Interface())
+	v, err = setValue(p.Parent(), v, slice.Interface(), false)
 	if err != nil {
 		return v, err
 	}
 
 	// Write: s[i] = x
-	return p.Set(v, op.Value)
+	return setValue(p, v, op.Value, op.Strict)
 }
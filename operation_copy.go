@@ -4,34 +4,33 @@ import (
 	"fmt"
 
 	"github.com/mitchellh/copystructure"
-	"github.com/mitchellh/pointerstructure"
 )
 
 // RFC6902 4.5
 func opCopy(op *Operation, v interface{}) (interface{}, error) {
 	// Parse the path. We do this even though we don't use it to
 	// avoid syntax errors causing partial applies.
-	_, err := pointerstructure.Parse(op.Path)
+	_, err := parsePointer(op.Path)
 	if err != nil {
 		return v, err
 	}
 
 	// Parse the from path, which must exist
-	from, err := pointerstructure.Parse(op.From)
+	from, err := parsePointer(op.From)
 	if err != nil {
 		return v, err
 	}
 
 	// Get the from value, which must exist
-	fromValue, err := from.Get(v)
+	fromValue, err := getValue(from, v)
 	if err != nil {
 		return v, err
 	}
 
 	// Perform a deep copy if requested. This is unique to Go to avoid
 	// references matching. We make it opt-out since it feels like the obvious
-	// behavior when requesting a "copy".
-	if !op.Shallow {
+	// behavior when requesting a "copy". A nil value has nothing to copy.
+	if !op.Shallow && fromValue != nil {
 		copy, err := copystructure.Copy(fromValue)
 		if err != nil {
 			return v, fmt.Errorf("error copying from value: %s", err)
@@ -50,5 +49,5 @@ func opCopy(op *Operation, v interface{}) (interface{}, error) {
 	}
 
 	// Add
-	return addOp.Apply(v)
+	return opAdd(addOp, v)
 }
@@ -0,0 +1,165 @@
+package patchstructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// opIncrement adds the number Value to the number at Path. This isn't part
+// of RFC6902 but is useful since it doesn't depend on the current value
+// like a "replace" does, so concurrent increments don't lose updates.
+func opIncrement(op *Operation, v interface{}) (interface{}, error) {
+	// Parse the path
+	pointer, err := parsePointer(op.Path)
+	if err != nil {
+		return v, err
+	}
+
+	// The target location must exist
+	target, err := lookup(pointer, v, false)
+	if err != nil {
+		return v, err
+	}
+
+	// Read-only struct fields can't be changed
+	if err := readOnly(OpIncrement, pointer, v, op.Value); err != nil {
+		return v, err
+	}
+	target = indirect(target, false)
+	if n, ok := jsonNumber(target); ok {
+		return incrementNumber(pointer, v, n, op)
+	}
+	if !target.IsValid() || !isNumber(target.Kind()) {
+		return v, fmt.Errorf(
+			"%w: can only increment numbers, got %s",
+			ErrTypeMismatch, target.Kind())
+	}
+
+	delta, err := incrementDelta(op)
+	if err != nil {
+		return v, err
+	}
+
+	// The result has the same type as the target
+	result := reflect.New(target.Type()).Elem()
+	if testIsFloat(target.Kind()) {
+		f := target.Float() + testFloat(delta)
+		if math.IsInf(f, 0) || result.OverflowFloat(f) {
+			return v, fmt.Errorf(
+				"%w: incrementing %v by %v overflows %s",
+				ErrTypeMismatch, target.Interface(), op.Value, target.Type())
+		}
+
+		result.SetFloat(f)
+	} else {
+		// We do integer math with big.Int so we can check that the result
+		// fits in the target type regardless of the types involved.
+		current, err := incrementInt(target)
+		if err != nil {
+			return v, err
+		}
+
+		d, err := incrementInt(delta)
+		if err != nil {
+			return v, err
+		}
+
+		sum := new(big.Int).Add(current, d)
+		if !incrementSet(result, sum) {
+			return v, fmt.Errorf(
+				"%w: incrementing %v by %v overflows %s",
+				ErrTypeMismatch, target.Interface(), op.Value, target.Type())
+		}
+	}
+
+	return setValue(pointer, v, result.Interface(), false)
+}
+
+// incrementDelta returns the number to increment by.
+func incrementDelta(op *Operation) (reflect.Value, error) {
+	delta := indirect(reflect.ValueOf(op.Value), false)
+	delta, _ = jsonNumber(delta)
+	if !delta.IsValid() || !isNumber(delta.Kind()) {
+		return delta, fmt.Errorf(
+			"%w: can only increment by a number, got %T", ErrTypeMismatch, op.Value)
+	}
+
+	return delta, nil
+}
+
+// incrementNumber increments a json.Number target, whose value is n. A
+// json.Number has no Go numeric type so the result is a json.Number that
+// is an integer if both numbers are integers.
+func incrementNumber(
+	pointer *pointerstructure.Pointer,
+	v interface{},
+	n reflect.Value,
+	op *Operation) (interface{}, error) {
+	delta, err := incrementDelta(op)
+	if err != nil {
+		return v, err
+	}
+
+	if !testIsFloat(n.Kind()) {
+		current, _ := incrementInt(n)
+		if d, err := incrementInt(delta); err == nil {
+			sum := new(big.Int).Add(current, d)
+			return setValue(pointer, v, json.Number(sum.String()), false)
+		}
+	}
+
+	f := testFloat(n) + testFloat(delta)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return v, fmt.Errorf(
+			"%w: incrementing %v by %v overflows", ErrTypeMismatch, n.Interface(), op.Value)
+	}
+
+	return setValue(pointer, v, json.Number(strconv.FormatFloat(f, 'g', -1, 64)), false)
+}
+
+// incrementInt returns the number v as a big.Int. Floats must be whole
+// numbers since they're added to an integer.
+func incrementInt(v reflect.Value) (*big.Int, error) {
+	switch {
+	case testIsInt(v.Kind()):
+		return big.NewInt(v.Int()), nil
+
+	case testIsUint(v.Kind()):
+		return new(big.Int).SetUint64(v.Uint()), nil
+	}
+
+	f := v.Float()
+	if math.IsInf(f, 0) || math.IsNaN(f) || f != math.Trunc(f) {
+		return nil, fmt.Errorf(
+			"%w: can't increment an integer by %v", ErrTypeMismatch, f)
+	}
+
+	result, _ := big.NewFloat(f).Int(nil)
+	return result, nil
+}
+
+// incrementSet sets the integer value v to n. This returns false if n
+// overflows the type of v.
+func incrementSet(v reflect.Value, n *big.Int) bool {
+	if testIsUint(v.Kind()) {
+		if n.Sign() < 0 || !n.IsUint64() || v.OverflowUint(n.Uint64()) {
+			return false
+		}
+
+		v.SetUint(n.Uint64())
+		return true
+	}
+
+	if !n.IsInt64() || v.OverflowInt(n.Int64()) {
+		return false
+	}
+
+	v.SetInt(n.Int64())
+	return true
+}
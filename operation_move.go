@@ -3,21 +3,19 @@ package patchstructure
 import (
 	"fmt"
 	"reflect"
-
-	"github.com/mitchellh/pointerstructure"
 )
 
 // RFC6902 4.4
 func opMove(op *Operation, v interface{}) (interface{}, error) {
 	// Parse the path. We do this even though we don't use it to
 	// avoid syntax errors causing partial applies.
-	to, err := pointerstructure.Parse(op.Path)
+	to, err := parsePointer(op.Path)
 	if err != nil {
 		return v, err
 	}
 
 	// Parse the from path, which must exist
-	from, err := pointerstructure.Parse(op.From)
+	from, err := parsePointer(op.From)
 	if err != nil {
 		return v, err
 	}
@@ -27,16 +25,26 @@ func opMove(op *Operation, v interface{}) (interface{}, error) {
 	if len(from.Parts) < len(to.Parts) {
 		if reflect.DeepEqual(from.Parts, to.Parts[:len(from.Parts)]) {
 			return v, fmt.Errorf(
-				"move cannot move into a child path of the from path")
+				"%w: move cannot move into a child path of the from path",
+				ErrInvalidPath)
 		}
 	}
 
 	// Get the from value, which must exist
-	fromValue, err := from.Get(v)
+	fromValue, err := getValue(from, v)
 	if err != nil {
 		return v, err
 	}
 
+	// Check both paths before removing so a read-only field doesn't cause
+	// the value to be removed without being added.
+	if err := readOnly(OpRemove, from, v, nil); err != nil {
+		return v, err
+	}
+	if err := readOnly(OpAdd, to, v, fromValue); err != nil {
+		return v, err
+	}
+
 	// "This operation is functionally identical to a "remove" operation on
 	// the "from" location, followed immediately by an "add" operation at
 	// the target location with the value that was just removed."
@@ -52,11 +60,11 @@ func opMove(op *Operation, v interface{}) (interface{}, error) {
 	}
 
 	// Remove first
-	v, err = removeOp.Apply(v)
+	v, err = opRemove(removeOp, v)
 	if err != nil {
 		return v, err
 	}
 
 	// Add
-	return addOp.Apply(v)
+	return opAdd(addOp, v)
 }
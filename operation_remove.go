@@ -1,13 +1,9 @@
 package patchstructure
 
-import (
-	"github.com/mitchellh/pointerstructure"
-)
-
 // RFC6902 4.2
 func opRemove(op *Operation, v interface{}) (interface{}, error) {
 	// Parse the path
-	pointer, err := pointerstructure.Parse(op.Path)
+	pointer, err := parsePointer(op.Path)
 	if err != nil {
 		return v, err
 	}
@@ -16,10 +12,16 @@ func opRemove(op *Operation, v interface{}) (interface{}, error) {
 	// exists. If it doesn't, it is an error. To quote the RFC:
 	//
 	// "The target location MUST exist for the operation to be successful."
-	if _, err := pointer.Get(v); err != nil {
+	if _, err := getValue(pointer, v); err != nil {
+		return v, err
+	}
+
+	// Read-only struct fields can't be changed
+	if err := readOnly(OpRemove, pointer, v, nil); err != nil {
 		return v, err
 	}
 
-	// Delete always does the right thing
-	return pointer.Delete(v)
+	// Delete always does the right thing. For struct fields this
+	// sets the field to its zero value.
+	return deleteValue(pointer, v)
 }
@@ -1,13 +1,9 @@
 package patchstructure
 
-import (
-	"github.com/mitchellh/pointerstructure"
-)
-
 // RFC6902 4.3
 func opReplace(op *Operation, v interface{}) (interface{}, error) {
 	// Parse the path
-	pointer, err := pointerstructure.Parse(op.Path)
+	pointer, err := parsePointer(op.Path)
 	if err != nil {
 		return v, err
 	}
@@ -16,10 +12,15 @@ func opReplace(op *Operation, v interface{}) (interface{}, error) {
 	// exists. If it doesn't, it is an error. To quote the RFC:
 	//
 	// "The target location MUST exist for the operation to be successful."
-	if _, err := pointer.Get(v); err != nil {
+	if _, err := getValue(pointer, v); err != nil {
+		return v, err
+	}
+
+	// Read-only struct fields can't be changed
+	if err := readOnly(OpReplace, pointer, v, op.Value); err != nil {
 		return v, err
 	}
 
 	// Set always does the right thing
-	return pointer.Set(v, op.Value)
+	return setValue(pointer, v, op.Value, op.Strict)
 }
@@ -3,11 +3,28 @@ package patchstructure
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"testing"
 )
 
 func TestOperationApply(t *testing.T) {
+	type testInner struct {
+		Value int
+	}
+
+	type testStruct struct {
+		Name    string
+		Tagged  string `json:"tagged"`
+		Renamed string `json:"json_name" patchstructure:"name"`
+		Ignored string `json:"-"`
+		Omitted string `patchstructure:",omit"`
+		Inner   *testInner
+		Labels  map[string]string
+		Array   [3]int
+		private string
+	}
+
 	cases := []struct {
 		Name      string
 		Operation Operation
@@ -98,6 +115,42 @@ func TestOperationApply(t *testing.T) {
 			false,
 		},
 
+		{
+			"add: slice index at length",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/2",
+				Value: "bar",
+			},
+			[]interface{}{1, 2},
+			[]interface{}{1, 2, "bar"},
+			false,
+		},
+
+		{
+			"add: slice index with leading zero",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/01",
+				Value: "bar",
+			},
+			[]interface{}{1, 2},
+			nil,
+			true,
+		},
+
+		{
+			"add: slice index with sign",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/+1",
+				Value: "bar",
+			},
+			[]interface{}{1, 2},
+			nil,
+			true,
+		},
+
 		// "The specified index MUST NOT be greater than the
 		// number of elements in the array"
 		{
@@ -126,267 +179,1336 @@ func TestOperationApply(t *testing.T) {
 			true,
 		},
 
-		//-----------------------------------------------------------
-		// remove
-		//-----------------------------------------------------------
-
 		{
-			"remove: map element",
+			"add: struct field",
 			Operation{
-				Op:   OpRemove,
-				Path: "/foo/bar",
-			},
-			map[string]interface{}{
-				"foo": map[string]interface{}{
-					"bar": 42,
-				},
+				Op:    OpAdd,
+				Path:  "/Name",
+				Value: "bar",
 			},
-			map[string]interface{}{
-				"foo": map[string]interface{}{},
+			&testStruct{Name: "foo"},
+			&testStruct{Name: "bar"},
+			false,
+		},
+
+		{
+			"add: struct field by value",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/Name",
+				Value: "bar",
 			},
+			testStruct{Name: "foo"},
+			testStruct{Name: "bar"},
 			false,
 		},
 
 		{
-			"remove: map element that doesn't exist",
+			"add: struct field in map",
 			Operation{
-				Op:   OpRemove,
-				Path: "/foo/baz",
+				Op:    OpAdd,
+				Path:  "/a/Name",
+				Value: "bar",
 			},
-			map[string]interface{}{
-				"foo": map[string]interface{}{
-					"bar": 42,
-				},
+			map[string]interface{}{"a": testStruct{}},
+			map[string]interface{}{"a": testStruct{Name: "bar"}},
+			false,
+		},
+
+		{
+			"add: struct field json tag",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/tagged",
+				Value: "bar",
 			},
-			nil,
-			true,
+			&testStruct{},
+			&testStruct{Tagged: "bar"},
+			false,
 		},
 
 		{
-			"remove: slice index at 0",
+			"add: struct field patchstructure tag",
 			Operation{
-				Op:   OpRemove,
-				Path: "/0",
+				Op:    OpAdd,
+				Path:  "/name",
+				Value: "bar",
 			},
-			[]interface{}{1, 2},
-			[]interface{}{2},
+			&testStruct{},
+			&testStruct{Renamed: "bar"},
 			false,
 		},
 
 		{
-			"remove: slice index that doesn't exist",
+			"add: struct field overridden by tag",
 			Operation{
-				Op:   OpRemove,
-				Path: "/4",
+				Op:    OpAdd,
+				Path:  "/Tagged",
+				Value: "bar",
 			},
-			[]interface{}{1, 2},
+			&testStruct{},
 			nil,
 			true,
 		},
 
-		//-----------------------------------------------------------
-		// replace
-		//-----------------------------------------------------------
-
 		{
-			"replace: root",
+			"add: struct field ignored",
 			Operation{
-				Op:    OpReplace,
-				Path:  "",
+				Op:    OpAdd,
+				Path:  "/Ignored",
 				Value: "bar",
 			},
+			&testStruct{},
 			nil,
-			"bar",
-			false,
+			true,
 		},
 
 		{
-			"replace: new member",
+			"add: struct field omitted",
 			Operation{
-				Op:    OpReplace,
-				Path:  "/a",
+				Op:    OpAdd,
+				Path:  "/Omitted",
 				Value: "bar",
 			},
-			map[string]interface{}{},
+			&testStruct{},
 			nil,
 			true,
 		},
 
 		{
-			"replace: existing member",
+			"add: struct field unexported",
 			Operation{
-				Op:    OpReplace,
-				Path:  "/a",
+				Op:    OpAdd,
+				Path:  "/private",
 				Value: "bar",
 			},
-			map[string]interface{}{"a": "foo"},
-			map[string]interface{}{"a": "bar"},
-			false,
+			&testStruct{},
+			nil,
+			true,
 		},
 
-		// NOTE(mitchellh): It is unclear what the RFC expects for this
-		// behavior. It says that the target path must exist, and yet
-		// I'm unsure if a "-" addr exists... it isn't clear.
 		{
-			"replace: slice append",
+			"add: struct field wrong type",
 			Operation{
-				Op:    OpReplace,
-				Path:  "/-",
-				Value: "bar",
+				Op:    OpAdd,
+				Path:  "/Name",
+				Value: 42,
 			},
-			[]interface{}{1, 2},
+			&testStruct{},
 			nil,
 			true,
 		},
 
 		{
-			"replace: slice index",
+			"add: nested nil struct pointer",
 			Operation{
-				Op:    OpReplace,
-				Path:  "/1",
-				Value: "bar",
+				Op:    OpAdd,
+				Path:  "/Inner/Value",
+				Value: 42,
 			},
-			[]interface{}{1, 2},
-			[]interface{}{1, "bar"},
+			&testStruct{},
+			&testStruct{Inner: &testInner{Value: 42}},
 			false,
 		},
 
 		{
-			"replace: slice index at 0",
+			"add: nested nil struct pointer by value",
 			Operation{
-				Op:    OpReplace,
-				Path:  "/0",
-				Value: "bar",
+				Op:    OpAdd,
+				Path:  "/Inner/Value",
+				Value: 42,
 			},
-			[]interface{}{1, 2},
-			[]interface{}{"bar", 2},
+			testStruct{},
+			testStruct{Inner: &testInner{Value: 42}},
 			false,
 		},
 
 		{
-			"replace: slice index out of bounds",
+			"add: nil map in struct",
 			Operation{
-				Op:    OpReplace,
-				Path:  "/4",
-				Value: "bar",
+				Op:    OpAdd,
+				Path:  "/Labels/a",
+				Value: "b",
 			},
-			[]interface{}{1, 2},
+			&testStruct{},
+			&testStruct{Labels: map[string]string{"a": "b"}},
+			false,
+		},
+
+		{
+			"add: array index",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/1",
+				Value: 42,
+			},
+			[3]int{1, 2, 3},
+			[3]int{1, 42, 3},
+			false,
+		},
+
+		{
+			"add: array append",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/-",
+				Value: 42,
+			},
+			[3]int{1, 2, 3},
 			nil,
 			true,
 		},
 
 		{
-			"replace: non-existent container",
+			"add: array index out of bounds",
 			Operation{
-				Op:    OpReplace,
-				Path:  "/b/a",
-				Value: "bar",
+				Op:    OpAdd,
+				Path:  "/3",
+				Value: 42,
 			},
-			map[string]interface{}{"a": "foo"},
+			[3]int{1, 2, 3},
 			nil,
 			true,
 		},
 
+		{
+			"add: array in struct",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/Array/0",
+				Value: 42,
+			},
+			&testStruct{},
+			&testStruct{Array: [3]int{42, 0, 0}},
+			false,
+		},
+
+		{
+			"add: array in map",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/a/2",
+				Value: 42,
+			},
+			map[string]interface{}{"a": [3]int{1, 2, 3}},
+			map[string]interface{}{"a": [3]int{1, 2, 42}},
+			false,
+		},
+
 		//-----------------------------------------------------------
-		// move
+		// add: coercion of JSON-decoded values
 		//-----------------------------------------------------------
 
 		{
-			"move: object member",
+			"add: coerce number",
 			Operation{
-				Op:   OpMove,
-				Path: "/b",
-				From: "/a",
+				Op:    OpAdd,
+				Path:  "/b",
+				Value: float64(42),
 			},
-			map[string]interface{}{"a": "bar"},
-			map[string]interface{}{"b": "bar"},
+			map[string]int{"a": 1},
+			map[string]int{"a": 1, "b": 42},
 			false,
 		},
 
 		{
-			"move: slice index",
+			"add: coerce lossy number",
 			Operation{
-				Op:   OpMove,
-				Path: "/2",
-				From: "/1",
+				Op:    OpAdd,
+				Path:  "/b",
+				Value: float64(1.5),
 			},
-			[]interface{}{1, 2, 3, 4},
-			[]interface{}{1, 3, 2, 4},
+			map[string]int{"a": 1},
+			map[string]int{"a": 1, "b": 1},
 			false,
 		},
 
 		{
-			"move: into self subpath",
+			"add: coerce lossy number strict",
 			Operation{
-				Op:   OpMove,
-				Path: "/b/a",
-				From: "/b",
+				Op:     OpAdd,
+				Path:   "/b",
+				Value:  float64(1.5),
+				Strict: true,
 			},
-			map[string]interface{}{
-				"b": map[string]interface{}{
-					"a": 42,
-				},
+			map[string]int{"a": 1},
+			nil,
+			true,
+		},
+
+		{
+			"add: coerce overflow strict",
+			Operation{
+				Op:     OpAdd,
+				Path:   "/0",
+				Value:  float64(300),
+				Strict: true,
 			},
+			[]int8{1},
 			nil,
 			true,
 		},
 
-		//-----------------------------------------------------------
-		// copy
-		//-----------------------------------------------------------
+		{
+			"add: coerce exact number strict",
+			Operation{
+				Op:     OpAdd,
+				Path:   "/0",
+				Value:  float64(100),
+				Strict: true,
+			},
+			[]int8{1},
+			[]int8{100, 1},
+			false,
+		},
 
 		{
-			"copy: object member",
+			"add: coerce json.Number",
 			Operation{
-				Op:   OpCopy,
-				Path: "/b",
-				From: "/a",
+				Op:     OpAdd,
+				Path:   "/b",
+				Value:  json.Number("9007199254740993"),
+				Strict: true,
 			},
-			map[string]interface{}{"a": "bar"},
-			map[string]interface{}{"a": "bar", "b": "bar"},
+			map[string]int64{"a": 1},
+			map[string]int64{"a": 1, "b": 9007199254740993},
 			false,
 		},
 
 		{
-			"copy: slice index",
+			"add: coerce json.Number uint64",
 			Operation{
-				Op:   OpCopy,
-				Path: "/2",
-				From: "/1",
+				Op:     OpAdd,
+				Path:   "/b",
+				Value:  json.Number("18446744073709551615"),
+				Strict: true,
 			},
-			[]interface{}{1, 2, 3, 4},
-			[]interface{}{1, 2, 2, 3, 4},
+			map[string]uint64{"a": 1},
+			map[string]uint64{"a": 1, "b": 18446744073709551615},
 			false,
 		},
 
 		{
-			"copy: non-existent member",
+			"add: coerce json.Number float",
 			Operation{
-				Op:   OpCopy,
-				Path: "/b",
-				From: "/a",
+				Op:    OpAdd,
+				Path:  "/b",
+				Value: json.Number("1.5"),
 			},
-			map[string]interface{}{},
+			map[string]float32{"a": 1},
+			map[string]float32{"a": 1, "b": 1.5},
+			false,
+		},
+
+		{
+			"add: coerce json.Number lossy strict",
+			Operation{
+				Op:     OpAdd,
+				Path:   "/b",
+				Value:  json.Number("1.5"),
+				Strict: true,
+			},
+			map[string]int{"a": 1},
 			nil,
 			true,
 		},
 
-		//-----------------------------------------------------------
-		// test
-		//-----------------------------------------------------------
-
 		{
-			"test: member",
+			"add: coerce json.Number to string",
 			Operation{
-				Op:    OpTest,
-				Path:  "/a",
-				Value: "bar",
+				Op:    OpAdd,
+				Path:  "/b",
+				Value: json.Number("1"),
 			},
-			map[string]interface{}{"a": "bar"},
-			map[string]interface{}{"a": "bar"},
-			false,
+			map[string]string{"a": "1"},
+			nil,
+			true,
 		},
-	}
+
+		{
+			"add: coerce number to json.Number",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/b",
+				Value: float64(1.5),
+			},
+			map[string]json.Number{"a": "1"},
+			map[string]json.Number{"a": "1", "b": "1.5"},
+			false,
+		},
+
+		{
+			"add: coerce map to struct",
+			Operation{
+				Op:   OpAdd,
+				Path: "/-",
+				Value: map[string]interface{}{
+					"Name":   "foo",
+					"tagged": "bar",
+					"Inner":  map[string]interface{}{"value": float64(42)},
+					"Array":  []interface{}{float64(1), float64(2), float64(3)},
+					"Labels": map[string]interface{}{"a": "b"},
+					"Nope":   "ignored",
+				},
+			},
+			[]testStruct{},
+			[]testStruct{
+				{
+					Name:   "foo",
+					Tagged: "bar",
+					Inner:  &testInner{Value: 42},
+					Array:  [3]int{1, 2, 3},
+					Labels: map[string]string{"a": "b"},
+				},
+			},
+			false,
+		},
+
+		{
+			"add: coerce map to struct unknown field strict",
+			Operation{
+				Op:   OpAdd,
+				Path: "/-",
+				Value: map[string]interface{}{
+					"Nope": "ignored",
+				},
+				Strict: true,
+			},
+			[]testStruct{},
+			nil,
+			true,
+		},
+
+		{
+			"add: coerce slice",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/a",
+				Value: []interface{}{"a", "b"},
+			},
+			map[string][]string{},
+			map[string][]string{"a": []string{"a", "b"}},
+			false,
+		},
+
+		{
+			"add: coerce slice wrong element type",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/a",
+				Value: []interface{}{"a", float64(1)},
+			},
+			map[string][]string{},
+			nil,
+			true,
+		},
+
+		{
+			"add: coerce array wrong length",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/Array",
+				Value: []interface{}{float64(1)},
+			},
+			&testStruct{},
+			nil,
+			true,
+		},
+
+		{
+			"add: coerce map keys",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/a",
+				Value: map[string]interface{}{"1": "b"},
+			},
+			map[string]map[int]string{},
+			map[string]map[int]string{"a": map[int]string{1: "b"}},
+			false,
+		},
+
+		{
+			"add: coerce null member",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/b",
+				Value: map[string]interface{}{"a": nil},
+			},
+			map[string]map[string][]int{},
+			map[string]map[string][]int{"b": map[string][]int{"a": nil}},
+			false,
+		},
+
+		{
+			"add: coerce null element",
+			Operation{
+				Op:    OpAdd,
+				Path:  "/b",
+				Value: []interface{}{nil, float64(0)},
+			},
+			map[string][]*int{},
+			map[string][]*int{"b": []*int{nil, new(int)}},
+			false,
+		},
+
+		//-----------------------------------------------------------
+		// remove
+		//-----------------------------------------------------------
+
+		{
+			"remove: map element",
+			Operation{
+				Op:   OpRemove,
+				Path: "/foo/bar",
+			},
+			map[string]interface{}{
+				"foo": map[string]interface{}{
+					"bar": 42,
+				},
+			},
+			map[string]interface{}{
+				"foo": map[string]interface{}{},
+			},
+			false,
+		},
+
+		{
+			"remove: map element that doesn't exist",
+			Operation{
+				Op:   OpRemove,
+				Path: "/foo/baz",
+			},
+			map[string]interface{}{
+				"foo": map[string]interface{}{
+					"bar": 42,
+				},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"remove: slice index at 0",
+			Operation{
+				Op:   OpRemove,
+				Path: "/0",
+			},
+			[]interface{}{1, 2},
+			[]interface{}{2},
+			false,
+		},
+
+		{
+			"remove: slice index that doesn't exist",
+			Operation{
+				Op:   OpRemove,
+				Path: "/4",
+			},
+			[]interface{}{1, 2},
+			nil,
+			true,
+		},
+
+		{
+			"remove: struct field",
+			Operation{
+				Op:   OpRemove,
+				Path: "/Name",
+			},
+			&testStruct{Name: "foo", Tagged: "bar"},
+			&testStruct{Tagged: "bar"},
+			false,
+		},
+
+		{
+			"remove: nested struct pointer",
+			Operation{
+				Op:   OpRemove,
+				Path: "/a/Inner",
+			},
+			map[string]interface{}{
+				"a": testStruct{Inner: &testInner{}},
+			},
+			map[string]interface{}{
+				"a": testStruct{},
+			},
+			false,
+		},
+
+		{
+			"remove: struct field that doesn't exist",
+			Operation{
+				Op:   OpRemove,
+				Path: "/Nope",
+			},
+			&testStruct{},
+			nil,
+			true,
+		},
+
+		{
+			"remove: array index",
+			Operation{
+				Op:   OpRemove,
+				Path: "/0",
+			},
+			[3]int{1, 2, 3},
+			[3]int{2, 3, 0},
+			false,
+		},
+
+		{
+			"remove: array in struct",
+			Operation{
+				Op:   OpRemove,
+				Path: "/a/Array/1",
+			},
+			map[string]interface{}{
+				"a": testStruct{Array: [3]int{1, 2, 3}},
+			},
+			map[string]interface{}{
+				"a": testStruct{Array: [3]int{1, 3, 0}},
+			},
+			false,
+		},
+
+		//-----------------------------------------------------------
+		// replace
+		//-----------------------------------------------------------
+
+		{
+			"replace: root",
+			Operation{
+				Op:    OpReplace,
+				Path:  "",
+				Value: "bar",
+			},
+			nil,
+			"bar",
+			false,
+		},
+
+		{
+			"replace: new member",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/a",
+				Value: "bar",
+			},
+			map[string]interface{}{},
+			nil,
+			true,
+		},
+
+		{
+			"replace: existing member",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/a",
+				Value: "bar",
+			},
+			map[string]interface{}{"a": "foo"},
+			map[string]interface{}{"a": "bar"},
+			false,
+		},
+
+		// NOTE(mitchellh): It is unclear what the RFC expects for this
+		// behavior. It says that the target path must exist, and yet
+		// I'm unsure if a "-" addr exists... it isn't clear.
+		{
+			"replace: slice append",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/-",
+				Value: "bar",
+			},
+			[]interface{}{1, 2},
+			nil,
+			true,
+		},
+
+		{
+			"replace: slice index",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/1",
+				Value: "bar",
+			},
+			[]interface{}{1, 2},
+			[]interface{}{1, "bar"},
+			false,
+		},
+
+		{
+			"replace: slice index at 0",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/0",
+				Value: "bar",
+			},
+			[]interface{}{1, 2},
+			[]interface{}{"bar", 2},
+			false,
+		},
+
+		{
+			"replace: slice index out of bounds",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/4",
+				Value: "bar",
+			},
+			[]interface{}{1, 2},
+			nil,
+			true,
+		},
+
+		{
+			"replace: non-existent container",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/b/a",
+				Value: "bar",
+			},
+			map[string]interface{}{"a": "foo"},
+			nil,
+			true,
+		},
+
+		{
+			"replace: struct field in slice",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/1/Name",
+				Value: "bar",
+			},
+			[]testStruct{{}, {}},
+			[]testStruct{{}, {Name: "bar"}},
+			false,
+		},
+
+		{
+			"replace: array index",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/2",
+				Value: 42,
+			},
+			[3]int{1, 2, 3},
+			[3]int{1, 2, 42},
+			false,
+		},
+
+		{
+			"replace: coerce pointer",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/Inner",
+				Value: map[string]interface{}{"Value": float64(42)},
+			},
+			&testStruct{},
+			&testStruct{Inner: &testInner{Value: 42}},
+			false,
+		},
+
+		{
+			"replace: coerce json.Number",
+			Operation{
+				Op:    OpReplace,
+				Path:  "/Inner",
+				Value: map[string]interface{}{"Value": json.Number("42")},
+			},
+			&testStruct{},
+			&testStruct{Inner: &testInner{Value: 42}},
+			false,
+		},
+
+		{
+			"replace: coerce lossy strict",
+			Operation{
+				Op:     OpReplace,
+				Path:   "/Inner/Value",
+				Value:  float64(4.2),
+				Strict: true,
+			},
+			&testStruct{Inner: &testInner{}},
+			nil,
+			true,
+		},
+
+		//-----------------------------------------------------------
+		// move
+		//-----------------------------------------------------------
+
+		{
+			"move: object member",
+			Operation{
+				Op:   OpMove,
+				Path: "/b",
+				From: "/a",
+			},
+			map[string]interface{}{"a": "bar"},
+			map[string]interface{}{"b": "bar"},
+			false,
+		},
+
+		{
+			"move: slice index",
+			Operation{
+				Op:   OpMove,
+				Path: "/2",
+				From: "/1",
+			},
+			[]interface{}{1, 2, 3, 4},
+			[]interface{}{1, 3, 2, 4},
+			false,
+		},
+
+		{
+			"move: into self subpath",
+			Operation{
+				Op:   OpMove,
+				Path: "/b/a",
+				From: "/b",
+			},
+			map[string]interface{}{
+				"b": map[string]interface{}{
+					"a": 42,
+				},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"move: struct field",
+			Operation{
+				Op:   OpMove,
+				Path: "/tagged",
+				From: "/Name",
+			},
+			&testStruct{Name: "foo"},
+			&testStruct{Tagged: "foo"},
+			false,
+		},
+
+		{
+			"move: array index in struct",
+			Operation{
+				Op:   OpMove,
+				Path: "/Array/2",
+				From: "/Array/0",
+			},
+			&testStruct{Array: [3]int{1, 2, 3}},
+			&testStruct{Array: [3]int{2, 3, 1}},
+			false,
+		},
+
+		//-----------------------------------------------------------
+		// copy
+		//-----------------------------------------------------------
+
+		{
+			"copy: object member",
+			Operation{
+				Op:   OpCopy,
+				Path: "/b",
+				From: "/a",
+			},
+			map[string]interface{}{"a": "bar"},
+			map[string]interface{}{"a": "bar", "b": "bar"},
+			false,
+		},
+
+		{
+			"copy: slice index",
+			Operation{
+				Op:   OpCopy,
+				Path: "/2",
+				From: "/1",
+			},
+			[]interface{}{1, 2, 3, 4},
+			[]interface{}{1, 2, 2, 3, 4},
+			false,
+		},
+
+		{
+			"copy: non-existent member",
+			Operation{
+				Op:   OpCopy,
+				Path: "/b",
+				From: "/a",
+			},
+			map[string]interface{}{},
+			nil,
+			true,
+		},
+
+		//-----------------------------------------------------------
+		// test
+		//-----------------------------------------------------------
+
+		{
+			"test: member",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: "bar",
+			},
+			map[string]interface{}{"a": "bar"},
+			map[string]interface{}{"a": "bar"},
+			false,
+		},
+
+		{
+			"test: member not equal",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: "baz",
+			},
+			map[string]interface{}{"a": "bar"},
+			nil,
+			true,
+		},
+
+		{
+			"test: member doesn't exist",
+			Operation{
+				Op:    OpTest,
+				Path:  "/b",
+				Value: "bar",
+			},
+			map[string]interface{}{"a": "bar"},
+			nil,
+			true,
+		},
+
+		// "numbers: are considered equal if their values are
+		// numerically equal."
+		{
+			"test: number kinds",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: float64(1),
+			},
+			map[string]interface{}{"a": int(1)},
+			map[string]interface{}{"a": int(1)},
+			false,
+		},
+
+		{
+			"test: number kinds unsigned",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: int64(42),
+			},
+			map[string]interface{}{"a": uint8(42)},
+			map[string]interface{}{"a": uint8(42)},
+			false,
+		},
+
+		{
+			"test: number kinds negative unsigned",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: int64(-1),
+			},
+			map[string]interface{}{"a": uint64(1<<64 - 1)},
+			nil,
+			true,
+		},
+
+		{
+			"test: number not equal",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: float64(1.5),
+			},
+			map[string]interface{}{"a": int(1)},
+			nil,
+			true,
+		},
+
+		{
+			"test: large integer and float",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: float64(9007199254740992),
+			},
+			map[string]interface{}{"a": int64(9007199254740993)},
+			nil,
+			true,
+		},
+
+		{
+			"test: large integer and equal float",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: float64(1 << 62),
+			},
+			map[string]interface{}{"a": uint64(1 << 62)},
+			map[string]interface{}{"a": uint64(1 << 62)},
+			false,
+		},
+
+		{
+			"test: integer and NaN",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: math.NaN(),
+			},
+			map[string]interface{}{"a": 0},
+			nil,
+			true,
+		},
+
+		{
+			"test: number and string",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: "1",
+			},
+			map[string]interface{}{"a": int(1)},
+			nil,
+			true,
+		},
+
+		{
+			"test: json.Number",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: json.Number("9007199254740993"),
+			},
+			map[string]interface{}{"a": int64(9007199254740993)},
+			map[string]interface{}{"a": int64(9007199254740993)},
+			false,
+		},
+
+		{
+			"test: json.Number not equal",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: json.Number("9007199254740993"),
+			},
+			map[string]interface{}{"a": int64(9007199254740992)},
+			nil,
+			true,
+		},
+
+		{
+			"test: json.Number and string",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: "1",
+			},
+			map[string]interface{}{"a": json.Number("1")},
+			nil,
+			true,
+		},
+
+		// "arrays: are considered equal if they contain the same number of
+		// values, and if each value can be considered equal to the value at
+		// the corresponding position in the other array"
+		{
+			"test: slice types",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: []interface{}{"a", "b"},
+			},
+			map[string]interface{}{"a": []string{"a", "b"}},
+			map[string]interface{}{"a": []string{"a", "b"}},
+			false,
+		},
+
+		{
+			"test: slice and array",
+			Operation{
+				Op:    OpTest,
+				Path:  "/Array",
+				Value: []interface{}{float64(1), float64(2), float64(3)},
+			},
+			&testStruct{Array: [3]int{1, 2, 3}},
+			&testStruct{Array: [3]int{1, 2, 3}},
+			false,
+		},
+
+		{
+			"test: slice length",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: []interface{}{"a"},
+			},
+			map[string]interface{}{"a": []string{"a", "b"}},
+			nil,
+			true,
+		},
+
+		// "objects: are considered equal if they contain the same number
+		// of members, and if each member can be considered equal to a
+		// member in the other object, by comparing their keys (as strings)
+		// and their values"
+		{
+			"test: map types",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: map[string]interface{}{"b": float64(1)},
+			},
+			map[string]interface{}{"a": map[string]int{"b": 1}},
+			map[string]interface{}{"a": map[string]int{"b": 1}},
+			false,
+		},
+
+		{
+			"test: map extra member",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: map[string]interface{}{"b": 1, "c": 2},
+			},
+			map[string]interface{}{"a": map[string]int{"b": 1}},
+			nil,
+			true,
+		},
+
+		{
+			"test: struct and map",
+			Operation{
+				Op:   OpTest,
+				Path: "/Inner",
+				Value: map[string]interface{}{
+					"Value": float64(42),
+				},
+			},
+			&testStruct{Inner: &testInner{Value: 42}},
+			&testStruct{Inner: &testInner{Value: 42}},
+			false,
+		},
+
+		// "literals (false, true, and null): are considered equal if they
+		// are the same."
+		{
+			"test: null",
+			Operation{
+				Op:    OpTest,
+				Path:  "/Inner",
+				Value: nil,
+			},
+			&testStruct{},
+			&testStruct{},
+			false,
+		},
+
+		{
+			"test: null and false",
+			Operation{
+				Op:    OpTest,
+				Path:  "/a",
+				Value: false,
+			},
+			map[string]interface{}{"a": nil},
+			nil,
+			true,
+		},
+
+		//-----------------------------------------------------------
+		// inc
+		//-----------------------------------------------------------
+
+		{
+			"inc: int",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: 2,
+			},
+			map[string]interface{}{"a": 40},
+			map[string]interface{}{"a": 42},
+			false,
+		},
+
+		{
+			"inc: decrement",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: float64(-2),
+			},
+			map[string]int8{"a": 44},
+			map[string]int8{"a": 42},
+			false,
+		},
+
+		{
+			"inc: preserves kind",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/0",
+				Value: int64(2),
+			},
+			[]interface{}{uint16(40)},
+			[]interface{}{uint16(42)},
+			false,
+		},
+
+		{
+			"inc: float",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: 0.5,
+			},
+			map[string]float32{"a": 1},
+			map[string]float32{"a": 1.5},
+			false,
+		},
+
+		{
+			"inc: struct field",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/Inner/Value",
+				Value: float64(1),
+			},
+			&testStruct{Inner: &testInner{Value: 41}},
+			&testStruct{Inner: &testInner{Value: 42}},
+			false,
+		},
+
+		{
+			"inc: int overflow",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: 1,
+			},
+			map[string]int8{"a": 127},
+			nil,
+			true,
+		},
+
+		{
+			"inc: uint underflow",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: -1,
+			},
+			map[string]uint64{"a": 0},
+			nil,
+			true,
+		},
+
+		{
+			"inc: uint64 large",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: uint64(1 << 63),
+			},
+			map[string]uint64{"a": 1<<63 - 1},
+			map[string]uint64{"a": 1<<64 - 1},
+			false,
+		},
+
+		{
+			"inc: float32 overflow",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: math.MaxFloat32,
+			},
+			map[string]float32{"a": math.MaxFloat32},
+			nil,
+			true,
+		},
+
+		{
+			"inc: int by fraction",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: 0.5,
+			},
+			map[string]int{"a": 1},
+			nil,
+			true,
+		},
+
+		{
+			"inc: json.Number",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: json.Number("1"),
+			},
+			map[string]interface{}{"a": json.Number("9007199254740993")},
+			map[string]interface{}{"a": json.Number("9007199254740994")},
+			false,
+		},
+
+		{
+			"inc: json.Number by fraction",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: 0.5,
+			},
+			map[string]interface{}{"a": json.Number("1")},
+			map[string]interface{}{"a": json.Number("1.5")},
+			false,
+		},
+
+		{
+			"inc: non-number",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: 1,
+			},
+			map[string]interface{}{"a": "foo"},
+			nil,
+			true,
+		},
+
+		{
+			"inc: by non-number",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: "1",
+			},
+			map[string]interface{}{"a": 1},
+			nil,
+			true,
+		},
+
+		{
+			"inc: doesn't exist",
+			Operation{
+				Op:    OpIncrement,
+				Path:  "/b",
+				Value: 1,
+			},
+			map[string]interface{}{"a": 1},
+			nil,
+			true,
+		},
+	}
 
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
@@ -423,16 +1545,92 @@ func TestOperationJSON(t *testing.T) {
 			false,
 		},
 
+		{
+			"inc",
+			`{ "op": "inc", "path": "/a", "value": -1 }`,
+			&Operation{
+				Op:    OpIncrement,
+				Path:  "/a",
+				Value: float64(-1),
+			},
+			false,
+		},
+
+		{
+			"strict",
+			`{ "op": "add", "path": "/a", "value": 1, "strict": true }`,
+			&Operation{
+				Op:     OpAdd,
+				Path:   "/a",
+				Value:  float64(1),
+				Strict: true,
+			},
+			false,
+		},
+
 		{
 			"shallow",
-			`{ "op": "copy", "path": "/a/b/c", "shallow": true }`,
+			`{ "op": "copy", "from": "/a", "path": "/a/b/c", "shallow": true }`,
 			&Operation{
 				Op:      OpCopy,
 				Path:    "/a/b/c",
+				From:    "/a",
 				Shallow: true,
 			},
 			false,
 		},
+
+		{
+			"null value",
+			`{ "op": "add", "path": "/a", "value": null }`,
+			&Operation{
+				Op:   OpAdd,
+				Path: "/a",
+			},
+			false,
+		},
+
+		{
+			"missing value",
+			`{ "op": "add", "path": "/a" }`,
+			nil,
+			true,
+		},
+
+		{
+			"missing inc value",
+			`{ "op": "inc", "path": "/a" }`,
+			nil,
+			true,
+		},
+
+		{
+			"missing path",
+			`{ "op": "remove" }`,
+			nil,
+			true,
+		},
+
+		{
+			"null path",
+			`{ "op": "replace", "path": null, "value": 42 }`,
+			nil,
+			true,
+		},
+
+		{
+			"missing from",
+			`{ "op": "move", "path": "/a" }`,
+			nil,
+			true,
+		},
+
+		{
+			"unknown op",
+			`{ "op": "nope", "path": "/a" }`,
+			nil,
+			true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -452,3 +1650,84 @@ func TestOperationJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterOp(t *testing.T) {
+	// Append the value to the slice at the path if it isn't already in it.
+	opAppendUnique := RegisterOp("test-append-unique", func(op *Operation, v interface{}) (interface{}, error) {
+		pointer, err := parsePointer(op.Path)
+		if err != nil {
+			return v, err
+		}
+
+		raw, err := getValue(pointer, v)
+		if err != nil {
+			return v, err
+		}
+
+		s := reflect.ValueOf(raw)
+		for i := 0; i < s.Len(); i++ {
+			if reflect.DeepEqual(s.Index(i).Interface(), op.Value) {
+				return v, nil
+			}
+		}
+
+		addOp := &Operation{Op: OpAdd, Path: op.Path + "/-", Value: op.Value}
+		return addOp.Apply(v)
+	})
+
+	if opAppendUnique.String() != "test-append-unique" {
+		t.Fatalf("bad: %s", opAppendUnique)
+	}
+
+	// Decode the operations from JSON
+	var ops []*Operation
+	err := json.Unmarshal([]byte(`[
+		{ "op": "test-append-unique", "path": "/a", "value": "foo" },
+		{ "op": "test-append-unique", "path": "/a", "value": "bar" }
+	]`), &ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ops[0].Op != opAppendUnique {
+		t.Fatalf("bad: %#v", ops[0])
+	}
+
+	actual, err := Patch(map[string]interface{}{
+		"a": []interface{}{"foo"},
+	}, ops)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"a": []interface{}{"foo", "bar"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Encoding uses the name
+	raw, err := json.Marshal(ops[0])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if decoded["op"] != "test-append-unique" {
+		t.Fatalf("bad: %s", raw)
+	}
+}
+
+func TestRegisterOp_duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic")
+		}
+	}()
+
+	RegisterOp("add", func(op *Operation, v interface{}) (interface{}, error) {
+		return v, nil
+	})
+}
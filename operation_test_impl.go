@@ -2,32 +2,245 @@ package patchstructure
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
-
-	"github.com/mitchellh/pointerstructure"
 )
 
 // RFC6902 4.6
 func opTest(op *Operation, v interface{}) (interface{}, error) {
 	// Parse the path
-	pointer, err := pointerstructure.Parse(op.Path)
+	pointer, err := parsePointer(op.Path)
 	if err != nil {
 		return v, err
 	}
 
 	// Target location must exist
-	target, err := pointer.Get(v)
+	target, err := getValue(pointer, v)
 	if err != nil {
 		return v, err
 	}
 
-	// Perform the test with "reflect". This can be improved in the future
-	// with good reason since there are subtle type issues with reflect
-	// DeepEqual.
+	// Perform the test with the equality rules of the RFC rather than Go
+	// types, see testEqual.
 	err = nil
-	if !reflect.DeepEqual(target, op.Value) {
-		err = fmt.Errorf("values not equal: %#v != %#v", target, op.Value)
+	if !testEqual(reflect.ValueOf(target), reflect.ValueOf(op.Value)) {
+		err = fmt.Errorf(
+			"%w: values not equal: %#v != %#v", ErrTestFailed, target, op.Value)
 	}
 
 	return v, err
 }
+
+// testEqual compares the values a and b using the rules of RFC6902 4.6
+// applied to Go values:
+//
+// "strings: are considered equal if they contain the same number of
+// Unicode characters and their code points are byte-by-byte equal."
+//
+// "numbers: are considered equal if their values are numerically equal."
+// This is true for any combination of Go numeric kinds, and integers are
+// compared with floats exactly rather than by rounding them to a float.
+//
+// "arrays: are considered equal if they contain the same number of values,
+// and if each value can be considered equal to the value at the
+// corresponding position in the other array." This applies to any slice
+// or array regardless of the element type.
+//
+// "objects: are considered equal if they contain the same number of
+// members, and if each member can be considered equal to a member in the
+// other object, by comparing their keys (as strings) and their values."
+// Maps and structs are both objects, with struct fields keyed by the same
+// names used in paths.
+//
+// "literals (false, true, and null): are considered equal if they are the
+// same." Nil pointers, maps, slices, and interfaces are all null.
+//
+// A json.Number is a number rather than a string.
+func testEqual(a, b reflect.Value) bool {
+	a = testIndirect(a)
+	b = testIndirect(b)
+	a, _ = jsonNumber(a)
+	b, _ = jsonNumber(b)
+
+	switch {
+	case !a.IsValid() || !b.IsValid():
+		return a.IsValid() == b.IsValid()
+
+	case isNumber(a.Kind()) && isNumber(b.Kind()):
+		return testEqualNumber(a, b)
+
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return a.String() == b.String()
+
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return a.Bool() == b.Bool()
+
+	case testIsArray(a.Kind()) && testIsArray(b.Kind()):
+		if a.Len() != b.Len() {
+			return false
+		}
+
+		for i := 0; i < a.Len(); i++ {
+			if !testEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+
+		return true
+
+	case testIsObject(a.Kind()) && testIsObject(b.Kind()):
+		am := testMembers(a)
+		bm := testMembers(b)
+		if len(am) != len(bm) {
+			return false
+		}
+
+		for k, av := range am {
+			bv, ok := bm[k]
+			if !ok || !testEqual(av, bv) {
+				return false
+			}
+		}
+
+		return true
+
+	case a.Kind() != b.Kind():
+		return false
+
+	default:
+		// Anything else, such as functions or channels, has no JSON
+		// equivalent so we fall back to Go equality.
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
+
+// testIndirect dereferences pointers and interfaces. Nil values of any kind
+// that can be nil are returned as the invalid value to represent null.
+func testIndirect(v reflect.Value) reflect.Value {
+	for {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+
+			v = v.Elem()
+
+		case reflect.Map, reflect.Slice:
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+
+			return v
+
+		default:
+			return v
+		}
+	}
+}
+
+// testEqualNumber compares two numeric values of any kind.
+func testEqualNumber(a, b reflect.Value) bool {
+	switch {
+	case testIsInt(a.Kind()) && testIsInt(b.Kind()):
+		return a.Int() == b.Int()
+
+	case testIsUint(a.Kind()) && testIsUint(b.Kind()):
+		return a.Uint() == b.Uint()
+
+	case testIsInt(a.Kind()) && testIsUint(b.Kind()):
+		return a.Int() >= 0 && uint64(a.Int()) == b.Uint()
+
+	case testIsUint(a.Kind()) && testIsInt(b.Kind()):
+		return b.Int() >= 0 && a.Uint() == uint64(b.Int())
+
+	case testIsFloat(a.Kind()) && testIsFloat(b.Kind()):
+		return a.Float() == b.Float()
+
+	default:
+		// An integer and a float are compared exactly since converting a
+		// large integer to a float64 may round it to the float.
+		af, bf := testBigFloat(a), testBigFloat(b)
+		return af != nil && bf != nil && af.Cmp(bf) == 0
+	}
+}
+
+// testBigFloat returns the numeric value v as an exact big.Float. The
+// result is nil for NaN, which isn't equal to any number.
+func testBigFloat(v reflect.Value) *big.Float {
+	switch {
+	case testIsInt(v.Kind()):
+		return new(big.Float).SetInt64(v.Int())
+	case testIsUint(v.Kind()):
+		return new(big.Float).SetUint64(v.Uint())
+	case math.IsNaN(v.Float()):
+		return nil
+	default:
+		return new(big.Float).SetFloat64(v.Float())
+	}
+}
+
+// testFloat returns the numeric value v as a float64.
+func testFloat(v reflect.Value) float64 {
+	switch {
+	case testIsInt(v.Kind()):
+		return float64(v.Int())
+	case testIsUint(v.Kind()):
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// testMembers returns the members of an object keyed by name.
+func testMembers(v reflect.Value) map[string]reflect.Value {
+	result := make(map[string]reflect.Value)
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			result[fmt.Sprint(k.Interface())] = v.MapIndex(k)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := structFieldName(t.Field(i)); ok {
+				result[name] = v.Field(i)
+			}
+		}
+	}
+
+	return result
+}
+
+func testIsInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+func testIsUint(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
+func testIsFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func testIsArray(k reflect.Kind) bool {
+	return k == reflect.Slice || k == reflect.Array
+}
+
+func testIsObject(k reflect.Kind) bool {
+	return k == reflect.Map || k == reflect.Struct
+}
@@ -9,8 +9,28 @@
 // representing and applying changes to Go structures. With this in place,
 // diffs between structures can be represented, changes to a structure
 // can be treated as a log, etc.
+//
+// Struct fields are addressed in paths by name. The name is taken from the
+// "patchstructure" struct tag, then the "json" struct tag, and finally the
+// Go field name. A tag name of "-" and unexported fields can't be addressed.
+// Since struct fields can't be removed, "remove" sets a field to its zero
+// value. Nil pointers to structs are allocated when a path requires them.
+//
+// The "patchstructure" tag also accepts options after the name, such as
+// `patchstructure:"id,readonly"`. The "omit" option hides a field from
+// paths like a name of "-". The "readonly" option makes operations that
+// would change the field fail with a *ReadOnlyError. This includes
+// operations on paths within the field and replacing a struct, or a slice
+// or map of structs, that contains the field with a value that changes it.
+// Reading the field with "test" or as the "from" of a "copy" is allowed.
 package patchstructure
 
+import (
+	"fmt"
+
+	"github.com/mitchellh/copystructure"
+)
+
 // Patch applies the set of operations sequentially to the value v.
 //
 // Patch will halt at the first error. In this case, the returned value
@@ -21,15 +41,49 @@ package patchstructure
 // this functionality to the end user.
 //
 // If you wish to deep copy your structures take a look at the "copystruture"
-// library and call that prior to this.
-func Patch(v interface{}, ops []*Operation) (result interface{}, err error) {
-	result = v
-	for _, op := range ops {
-		result, err = op.Apply(result)
-		if err != nil {
-			return
-		}
+// library and call that prior to this, or use PatchAtomic.
+//
+// Errors returned by Patch are always a *PatchError with the Index set
+// to the index of the operation that failed.
+//
+// Use PatchWithPolicy to check each operation with a Policy.
+func Patch(v interface{}, ops []*Operation) (interface{}, error) {
+	return PatchWithPolicy(v, ops, nil)
+}
+
+// PatchAtomic applies the set of operations sequentially to the value v
+// with the all-or-nothing semantics of the JSON Patch RFC.
+//
+// The value v is deep copied using copystructure prior to applying any
+// operations and the operations are applied to the copy. If any operation
+// fails, the original value v is returned unmodified along with the error.
+// If v can't be deep copied, an error is returned and no operations
+// are applied. Otherwise, errors are the same as Patch.
+func PatchAtomic(v interface{}, ops []*Operation) (interface{}, error) {
+	copy, err := copyValue(v)
+	if err != nil {
+		return v, err
+	}
+
+	result, err := Patch(copy, ops)
+	if err != nil {
+		return v, err
+	}
+
+	return result, nil
+}
+
+// copyValue returns a deep copy of the value v using copystructure.
+func copyValue(v interface{}) (interface{}, error) {
+	// A null value is valid but can't be copied
+	if v == nil {
+		return nil, nil
+	}
+
+	result, err := copystructure.Copy(v)
+	if err != nil {
+		return nil, fmt.Errorf("error copying value: %s", err)
 	}
 
-	return
+	return result, nil
 }
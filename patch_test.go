@@ -36,6 +36,20 @@ func TestPatch(t *testing.T) {
 			false,
 		},
 
+		{
+			"null value",
+			[]*Operation{
+				&Operation{
+					Op:    OpAdd,
+					Path:  "",
+					Value: 1,
+				},
+			},
+			nil,
+			1,
+			false,
+		},
+
 		{
 			"partial failure",
 			[]*Operation{
@@ -74,3 +88,97 @@ func TestPatch(t *testing.T) {
 		})
 	}
 }
+
+func TestPatchAtomic(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Ops      []*Operation
+		Input    interface{}
+		Expected interface{}
+		Err      bool
+	}{
+		{
+			"basic sequence",
+			[]*Operation{
+				&Operation{
+					Op:    OpAdd,
+					Path:  "/a",
+					Value: "A",
+				},
+
+				&Operation{
+					Op:   OpRemove,
+					Path: "/b",
+				},
+			},
+			map[string]interface{}{"b": 42},
+			map[string]interface{}{"a": "A"},
+			false,
+		},
+
+		{
+			"partial failure",
+			[]*Operation{
+				&Operation{
+					Op:    OpAdd,
+					Path:  "/a",
+					Value: "A",
+				},
+
+				&Operation{
+					Op:   OpRemove,
+					Path: "/c",
+				},
+
+				&Operation{
+					Op:   OpRemove,
+					Path: "/b",
+				},
+			},
+			map[string]interface{}{"b": 42},
+			map[string]interface{}{"b": 42},
+			true,
+		},
+
+		{
+			"nested partial failure",
+			[]*Operation{
+				&Operation{
+					Op:   OpRemove,
+					Path: "/a/0",
+				},
+
+				&Operation{
+					Op:    OpTest,
+					Path:  "/a/0",
+					Value: 42,
+				},
+			},
+			map[string]interface{}{
+				"a": []interface{}{1, 2},
+			},
+			map[string]interface{}{
+				"a": []interface{}{1, 2},
+			},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := PatchAtomic(tc.Input, tc.Ops)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+
+			// The input must never be modified
+			if err != nil && !reflect.DeepEqual(tc.Input, tc.Expected) {
+				t.Fatalf("input modified: %#v", tc.Input)
+			}
+		})
+	}
+}
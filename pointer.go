@@ -0,0 +1,488 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// This file contains the helpers the operations use to read and write the
+// value at a pointer. We parse pointers with pointerstructure but resolve
+// them ourselves so that struct fields can be addressed by their tag names
+// and so that values that Go copies (such as structs) are written back
+// into their parents after being modified.
+
+// parsePointer parses the path into a pointer.
+func parsePointer(path string) (*pointerstructure.Pointer, error) {
+	p, err := pointerstructure.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %s", ErrInvalidPath, path, err)
+	}
+
+	return p, nil
+}
+
+// getValue returns the value at pointer p within v.
+func getValue(p *pointerstructure.Pointer, v interface{}) (interface{}, error) {
+	val, err := lookup(p, v, false)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsValid() {
+		return nil, nil
+	}
+
+	return val.Interface(), nil
+}
+
+// setValue sets the value at pointer p within doc to value. The value is
+// coerced to the type of the location it is set in, see coerce for the
+// meaning of strict. The returned value is the document, which is a new
+// value if the root was set or if the root is a value type such as a struct.
+func setValue(
+	p *pointerstructure.Pointer,
+	doc, value interface{},
+	strict bool) (interface{}, error) {
+	if p.IsRoot() {
+		return value, nil
+	}
+
+	parent, err := lookup(p.Parent(), doc, true)
+	if err != nil {
+		return doc, err
+	}
+	parent, doc, err = allocValue(p.Parent(), doc, parent)
+	if err != nil {
+		return doc, err
+	}
+
+	part := p.Parts[len(p.Parts)-1]
+	switch parent.Kind() {
+	case reflect.Map:
+		key, err := mapKey(part, parent.Type().Key())
+		if err != nil {
+			return doc, err
+		}
+
+		elem, err := coerce(value, parent.Type().Elem(), strict)
+		if err != nil {
+			return doc, err
+		}
+
+		// A nil map can't be written to so we create one and write
+		// it back into the parent.
+		if parent.IsNil() {
+			m := reflect.MakeMap(parent.Type())
+			m.SetMapIndex(key, elem)
+			return setValue(p.Parent(), doc, m.Interface(), false)
+		}
+
+		parent.SetMapIndex(key, elem)
+		return doc, nil
+
+	case reflect.Slice:
+		elem, err := coerce(value, parent.Type().Elem(), strict)
+		if err != nil {
+			return doc, err
+		}
+
+		// Append can return a new slice so it must be written back
+		if part == "-" {
+			slice := reflect.Append(parent, elem)
+			return setValue(p.Parent(), doc, slice.Interface(), false)
+		}
+
+		idx, err := sliceIndex(part, parent.Len())
+		if err != nil {
+			return doc, err
+		}
+
+		parent.Index(idx).Set(elem)
+		return doc, nil
+
+	case reflect.Array:
+		// Arrays have a fixed length so there is nothing to append to.
+		if part == "-" {
+			return doc, fmt.Errorf(
+				"%s: %w: can't append to an array of fixed length %d",
+				p.String(), ErrInvalidIndex, parent.Len())
+		}
+
+		idx, err := sliceIndex(part, parent.Len())
+		if err != nil {
+			return doc, err
+		}
+
+		elem, err := coerce(value, parent.Type().Elem(), strict)
+		if err != nil {
+			return doc, err
+		}
+
+		// Arrays are values like structs, see below.
+		writeBack := !parent.CanSet()
+		if writeBack {
+			parent = addressableCopy(parent)
+		}
+
+		parent.Index(idx).Set(elem)
+		if writeBack {
+			return setValue(p.Parent(), doc, parent.Interface(), false)
+		}
+
+		return doc, nil
+
+	case reflect.Struct:
+		// If the struct isn't addressable then we have a copy. We modify
+		// a copy we can address and write that back into the parent.
+		writeBack := !parent.CanSet()
+		if writeBack {
+			parent = addressableCopy(parent)
+		}
+
+		field, err := structField(parent, part)
+		if err != nil {
+			return doc, err
+		}
+
+		elem, err := coerce(value, field.Type(), strict)
+		if err != nil {
+			return doc, err
+		}
+
+		field.Set(elem)
+		if writeBack {
+			return setValue(p.Parent(), doc, parent.Interface(), false)
+		}
+
+		return doc, nil
+
+	default:
+		return doc, fmt.Errorf(
+			"%s: %w: can't set a value in kind %s",
+			p.String(), ErrTypeMismatch, parent.Kind())
+	}
+}
+
+// deleteValue deletes the value at pointer p within doc. Slice elements
+// are removed and the following elements are shifted to the left. Arrays
+// can't shrink so the following elements are shifted to the left and the
+// last element is set to the zero value. Struct fields can't be removed
+// so they are set to their zero value.
+func deleteValue(p *pointerstructure.Pointer, doc interface{}) (interface{}, error) {
+	if p.IsRoot() {
+		return nil, nil
+	}
+
+	parent, err := lookup(p.Parent(), doc, false)
+	if err != nil {
+		return doc, err
+	}
+	parent = indirect(parent, false)
+
+	part := p.Parts[len(p.Parts)-1]
+	switch parent.Kind() {
+	case reflect.Map:
+		key, err := mapKey(part, parent.Type().Key())
+		if err != nil {
+			return doc, err
+		}
+
+		parent.SetMapIndex(key, reflect.Value{})
+		return doc, nil
+
+	case reflect.Slice:
+		idx, err := sliceIndex(part, parent.Len())
+		if err != nil {
+			return doc, err
+		}
+
+		// Mimic the following with reflection:
+		//
+		// copy(s[i:], s[i+1:])
+		// s[len(s)-1] = <zero>
+		// s = s[:len(s)-1]
+		reflect.Copy(parent.Slice(idx, parent.Len()), parent.Slice(idx+1, parent.Len()))
+		parent.Index(parent.Len() - 1).Set(reflect.Zero(parent.Type().Elem()))
+		slice := parent.Slice(0, parent.Len()-1)
+		return setValue(p.Parent(), doc, slice.Interface(), false)
+
+	case reflect.Array:
+		idx, err := sliceIndex(part, parent.Len())
+		if err != nil {
+			return doc, err
+		}
+
+		writeBack := !parent.CanSet()
+		if writeBack {
+			parent = addressableCopy(parent)
+		}
+
+		// Same as the slice above without shrinking the length
+		reflect.Copy(parent.Slice(idx, parent.Len()), parent.Slice(idx+1, parent.Len()))
+		parent.Index(parent.Len() - 1).Set(reflect.Zero(parent.Type().Elem()))
+		if writeBack {
+			return setValue(p.Parent(), doc, parent.Interface(), false)
+		}
+
+		return doc, nil
+
+	case reflect.Struct:
+		writeBack := !parent.CanSet()
+		if writeBack {
+			parent = addressableCopy(parent)
+		}
+
+		field, err := structField(parent, part)
+		if err != nil {
+			return doc, err
+		}
+
+		field.Set(reflect.Zero(field.Type()))
+		if writeBack {
+			return setValue(p.Parent(), doc, parent.Interface(), false)
+		}
+
+		return doc, nil
+
+	default:
+		return doc, fmt.Errorf(
+			"%s: %w: can't delete a value in kind %s",
+			p.String(), ErrTypeMismatch, parent.Kind())
+	}
+}
+
+// lookup walks v to the value at pointer p. If alloc is true then nil
+// pointers to structs along the way are allocated if they can be set.
+func lookup(p *pointerstructure.Pointer, v interface{}, alloc bool) (reflect.Value, error) {
+	current := reflect.ValueOf(v)
+	for i, part := range p.Parts {
+		current = indirect(current, alloc)
+
+		switch current.Kind() {
+		case reflect.Map:
+			key, err := mapKey(part, current.Type().Key())
+			if err != nil {
+				return current, fmt.Errorf("%s at part %d: %w", p.String(), i, err)
+			}
+
+			next := current.MapIndex(key)
+			if !next.IsValid() {
+				return current, fmt.Errorf(
+					"%s at part %d: %w: couldn't find key %q",
+					p.String(), i, ErrNotFound, part)
+			}
+
+			current = next
+
+		case reflect.Slice, reflect.Array:
+			idx, err := sliceIndex(part, current.Len())
+			if err != nil {
+				return current, fmt.Errorf("%s at part %d: %w", p.String(), i, err)
+			}
+
+			current = current.Index(idx)
+
+		case reflect.Struct:
+			field, err := structField(current, part)
+			if err != nil {
+				return current, fmt.Errorf("%s at part %d: %w", p.String(), i, err)
+			}
+
+			current = field
+
+		default:
+			return current, fmt.Errorf(
+				"%s at part %d: %w: can't get a value from kind %s",
+				p.String(), i, ErrTypeMismatch, current.Kind())
+		}
+	}
+
+	return current, nil
+}
+
+// indirect dereferences interfaces and pointers until it reaches a
+// concrete value. If alloc is true then nil pointers to structs are
+// allocated if they can be set.
+func indirect(v reflect.Value, alloc bool) reflect.Value {
+	for {
+		switch v.Kind() {
+		case reflect.Interface:
+			if v.IsNil() {
+				return v
+			}
+
+			v = v.Elem()
+
+		case reflect.Ptr:
+			if v.IsNil() {
+				if !alloc || !v.CanSet() || v.Type().Elem().Kind() != reflect.Struct {
+					return v
+				}
+
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+
+		default:
+			return v
+		}
+	}
+}
+
+// allocValue dereferences the value v found at pointer p within doc. If v
+// is a nil pointer to a struct that couldn't be allocated in place, a new
+// struct is allocated and set at p.
+func allocValue(
+	p *pointerstructure.Pointer,
+	doc interface{},
+	v reflect.Value) (reflect.Value, interface{}, error) {
+	v = indirect(v, true)
+	if v.Kind() != reflect.Ptr || v.Type().Elem().Kind() != reflect.Struct {
+		return v, doc, nil
+	}
+
+	ptr := reflect.New(v.Type().Elem())
+	doc, err := setValue(p, doc, ptr.Interface(), false)
+	return ptr.Elem(), doc, err
+}
+
+// addressableCopy returns a copy of v that can be modified.
+func addressableCopy(v reflect.Value) reflect.Value {
+	result := reflect.New(v.Type()).Elem()
+	result.Set(v)
+	return result
+}
+
+// structField returns the field of the struct v addressed by name.
+func structField(v reflect.Value, name string) (reflect.Value, error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if n, ok := structFieldName(t.Field(i)); ok && n == name {
+			return v.Field(i), nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf(
+		"%w: couldn't find struct field %q", ErrNotFound, name)
+}
+
+// structFieldName returns the name used to address a struct field in
+// a path. The "patchstructure" tag takes precedence over the "json" tag and
+// the Go field name is used if neither sets a name. The second result is
+// false if the field can't be addressed, which is the case for unexported
+// fields, a tag name of "-", and the "omit" option.
+func structFieldName(f reflect.StructField) (string, bool) {
+	// Unexported fields can't be set
+	if f.PkgPath != "" {
+		return "", false
+	}
+
+	if structFieldOption(f, "omit") {
+		return "", false
+	}
+
+	for _, key := range []string{"patchstructure", "json"} {
+		tag, ok := f.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+
+		name := tag
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name = tag[:idx]
+		}
+
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+
+	return f.Name, true
+}
+
+// structFieldOption returns true if the "patchstructure" tag of the field
+// has the option opt, such as "readonly" in `patchstructure:"id,readonly"`.
+func structFieldOption(f reflect.StructField, opt string) bool {
+	options := strings.Split(f.Tag.Get("patchstructure"), ",")
+	for _, o := range options[1:] {
+		if o == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mapKey converts the pointer part to a key of type t.
+func mapKey(part string, t reflect.Type) (reflect.Value, error) {
+	var result interface{}
+	var err error
+	switch t.Kind() {
+	case reflect.String, reflect.Interface:
+		result = part
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		result, err = strconv.ParseInt(part, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		result, err = strconv.ParseUint(part, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		result, err = strconv.ParseFloat(part, t.Bits())
+	case reflect.Bool:
+		result, err = strconv.ParseBool(part)
+	default:
+		return reflect.Value{}, fmt.Errorf(
+			"%w: unsupported map key type %s", ErrTypeMismatch, t)
+	}
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf(
+			"%w: error parsing key %q: %s", ErrNotFound, part, err)
+	}
+
+	return reflect.ValueOf(result).Convert(t), nil
+}
+
+// sliceIndex converts the pointer part to an index of a slice with
+// the given length.
+func sliceIndex(part string, length int) (int, error) {
+	idx, err := parseIndex(part)
+	if err != nil {
+		return 0, err
+	}
+
+	if idx >= length {
+		return 0, fmt.Errorf(
+			"%w: index %d is out of range (length = %d)",
+			ErrInvalidIndex, idx, length)
+	}
+
+	return idx, nil
+}
+
+// parseIndex parses the pointer part as a slice index. RFC 6901 only
+// allows digits without leading zeros, so signs and leading zeros that
+// strconv accepts are an error.
+func parseIndex(part string) (int, error) {
+	valid := part != "" && (part == "0" || part[0] != '0')
+	for _, c := range part {
+		if c < '0' || c > '9' {
+			valid = false
+		}
+	}
+	if !valid {
+		return 0, fmt.Errorf("%w: error parsing index %q", ErrInvalidIndex, part)
+	}
+
+	idx, err := strconv.Atoi(part)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"%w: error parsing index %q: %s", ErrInvalidIndex, part, err)
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,150 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Policy decides whether each operation of a patch may be applied. It is
+// consulted by PatchWithPolicy before each operation so rules such as
+// which paths may be modified can be enforced in one place.
+type Policy interface {
+	// Check is called with the operation that is about to be applied and
+	// returns the operation to apply in its place:
+	//
+	//   - Returning req.Operation allows the operation.
+	//   - Returning another operation rewrites it. The returned operation
+	//     is applied without being checked again.
+	//   - Returning nil skips the operation.
+	//   - Returning an error denies the operation and halts the patch.
+	//
+	// Check must not modify req.Operation or the values in req.
+	Check(req *PolicyRequest) (*Operation, error)
+}
+
+// PolicyFunc is a function that implements Policy.
+type PolicyFunc func(req *PolicyRequest) (*Operation, error)
+
+// Check calls f(req).
+func (f PolicyFunc) Check(req *PolicyRequest) (*Operation, error) {
+	return f(req)
+}
+
+// PolicyRequest is an operation that a Policy is asked to check.
+type PolicyRequest struct {
+	// Index is the index of the operation within the patch.
+	Index int
+
+	// Operation is the operation that is about to be applied.
+	Operation *Operation
+
+	// Path and From are the parts of the operation's paths with the
+	// JSON pointer escapes decoded. The root is an empty slice. From is
+	// nil unless the operation is a "move" or a "copy".
+	Path []string
+	From []string
+
+	// Current is the value at Path prior to the operation. It is nil if
+	// there is no value at Path.
+	Current interface{}
+
+	// Value is the new value set at Path. For a "move" or "copy" this is
+	// the value at From and for a "remove" this is nil. For other
+	// operations this is the operation's Value.
+	Value interface{}
+}
+
+// PatchWithPolicy applies the set of operations sequentially to the value
+// v the same as Patch, except that the policy is consulted before each
+// operation. See Policy for how it can allow, deny, or rewrite operations.
+// If policy is nil, this is the same as Patch.
+//
+// If the policy denies an operation, the error is a *PatchError whose Cause
+// wraps ErrDenied. If the policy's error already wraps ErrDenied then it
+// is the Cause so its type is kept for errors.As.
+//
+// Operations with Glob set are expanded before they're checked so that the
+// policy is consulted with an operation for each matching path.
+func PatchWithPolicy(v interface{}, ops []*Operation, policy Policy) (result interface{}, err error) {
+	result = v
+	for i, op := range ops {
+		result, err = policyApply(policy, i, op, result)
+		if err != nil {
+			err.(*PatchError).Index = i
+			return
+		}
+	}
+
+	return
+}
+
+// policyApply applies the operation op at index i to the value v if the
+// policy allows it. Errors returned are always a *PatchError.
+func policyApply(policy Policy, i int, op *Operation, v interface{}) (interface{}, error) {
+	if policy == nil {
+		return op.Apply(v)
+	}
+
+	ops, err := op.expand(v)
+	if err != nil {
+		return v, op.error(err)
+	}
+
+	for _, op := range ops {
+		checked, err := policyCheck(policy, i, op, v)
+		if err != nil {
+			return v, err
+		}
+		if checked == nil {
+			continue
+		}
+
+		if v, err = checked.Apply(v); err != nil {
+			return v, err
+		}
+	}
+
+	return v, nil
+}
+
+// policyCheck asks the policy to check the operation op at index i against
+// the value v. Errors returned are always a *PatchError.
+func policyCheck(policy Policy, i int, op *Operation, v interface{}) (*Operation, error) {
+	pointer, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, op.error(err)
+	}
+
+	req := &PolicyRequest{
+		Index:     i,
+		Operation: op,
+		Path:      append([]string{}, pointer.Parts...),
+		Value:     op.Value,
+	}
+	req.Current, _ = getValue(pointer, v)
+
+	switch op.Op {
+	case OpMove, OpCopy:
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, op.error(err)
+		}
+
+		req.From = append([]string{}, from.Parts...)
+		req.Value, _ = getValue(from, v)
+
+	case OpRemove:
+		req.Value = nil
+	}
+
+	result, err := policy.Check(req)
+	if err != nil {
+		if !errors.Is(err, ErrDenied) {
+			err = fmt.Errorf("%w: %s", ErrDenied, err)
+		}
+
+		return nil, op.error(err)
+	}
+
+	return result, nil
+}
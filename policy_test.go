@@ -0,0 +1,245 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPatchWithPolicy(t *testing.T) {
+	// Only allow changes within /spec and never remove /spec/name
+	specPolicy := PolicyFunc(func(req *PolicyRequest) (*Operation, error) {
+		paths := [][]string{req.Path}
+		if req.Operation.Op == OpMove {
+			paths = append(paths, req.From)
+		}
+		for _, p := range paths {
+			if len(p) < 2 || p[0] != "spec" {
+				return nil, fmt.Errorf("can't modify %q", req.Operation.Path)
+			}
+		}
+
+		if req.Operation.Op == OpRemove && reflect.DeepEqual(req.Path, []string{"spec", "name"}) {
+			return nil, fmt.Errorf("can't remove the name")
+		}
+
+		return req.Operation, nil
+	})
+
+	input := func() map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{"id": 1},
+			"spec":     map[string]interface{}{"name": "foo", "size": 2},
+		}
+	}
+
+	cases := []struct {
+		Name     string
+		Ops      []*Operation
+		Policy   Policy
+		Expected interface{}
+		Err      bool
+	}{
+		{
+			"no policy",
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/metadata"},
+			},
+			nil,
+			map[string]interface{}{
+				"spec": map[string]interface{}{"name": "foo", "size": 2},
+			},
+			false,
+		},
+
+		{
+			"allowed",
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/spec/size", Value: 3},
+				&Operation{Op: OpMove, From: "/spec/size", Path: "/spec/count"},
+				&Operation{Op: OpCopy, From: "/metadata/id", Path: "/spec/id"},
+			},
+			specPolicy,
+			map[string]interface{}{
+				"metadata": map[string]interface{}{"id": 1},
+				"spec":     map[string]interface{}{"name": "foo", "count": 3, "id": 1},
+			},
+			false,
+		},
+
+		{
+			"denied path",
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/metadata/id", Value: 2},
+			},
+			specPolicy,
+			nil,
+			true,
+		},
+
+		{
+			"denied from",
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/metadata/id", Path: "/spec/id"},
+			},
+			specPolicy,
+			nil,
+			true,
+		},
+
+		{
+			"denied remove",
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/spec/name"},
+			},
+			specPolicy,
+			nil,
+			true,
+		},
+
+		{
+			"rewrite",
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/spec/name", Value: "bar"},
+			},
+			PolicyFunc(func(req *PolicyRequest) (*Operation, error) {
+				return &Operation{Op: OpAdd, Path: "/spec/other", Value: req.Value}, nil
+			}),
+			map[string]interface{}{
+				"metadata": map[string]interface{}{"id": 1},
+				"spec":     map[string]interface{}{"name": "foo", "size": 2, "other": "bar"},
+			},
+			false,
+		},
+
+		{
+			"skip",
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/metadata"},
+				&Operation{Op: OpRemove, Path: "/spec/size"},
+			},
+			PolicyFunc(func(req *PolicyRequest) (*Operation, error) {
+				if req.Path[0] == "metadata" {
+					return nil, nil
+				}
+
+				return req.Operation, nil
+			}),
+			map[string]interface{}{
+				"metadata": map[string]interface{}{"id": 1},
+				"spec":     map[string]interface{}{"name": "foo"},
+			},
+			false,
+		},
+
+		{
+			"invalid path",
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "spec"},
+			},
+			PolicyFunc(func(req *PolicyRequest) (*Operation, error) {
+				t.Fatal("policy shouldn't be called")
+				return nil, nil
+			}),
+			nil,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := PatchWithPolicy(input(), tc.Ops, tc.Policy)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v\n\nexpected: %#v", actual, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestPatchWithPolicy_request(t *testing.T) {
+	var reqs []*PolicyRequest
+	policy := PolicyFunc(func(req *PolicyRequest) (*Operation, error) {
+		reqs = append(reqs, req)
+		return req.Operation, nil
+	})
+
+	ops := []*Operation{
+		&Operation{Op: OpReplace, Path: "/a~1b", Value: 2},
+		&Operation{Op: OpCopy, From: "/a~1b", Path: "/c"},
+		&Operation{Op: OpRemove, Path: "/c"},
+	}
+	_, err := PatchWithPolicy(map[string]interface{}{"a/b": 1}, ops, policy)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []*PolicyRequest{
+		{
+			Index:     0,
+			Operation: ops[0],
+			Path:      []string{"a/b"},
+			Current:   1,
+			Value:     2,
+		},
+		{
+			Index:     1,
+			Operation: ops[1],
+			Path:      []string{"c"},
+			From:      []string{"a/b"},
+			Value:     2,
+		},
+		{
+			Index:     2,
+			Operation: ops[2],
+			Path:      []string{"c"},
+			Current:   2,
+		},
+	}
+	if !reflect.DeepEqual(reqs, expected) {
+		t.Fatalf("bad: %#v", reqs)
+	}
+}
+
+func TestPatchWithPolicy_denied(t *testing.T) {
+	denied := fmt.Errorf("tenant: %w", ErrDenied)
+	cases := []struct {
+		Name  string
+		Err   error
+		Cause error
+	}{
+		{"wrapped", errors.New("nope"), nil},
+		{"already denied", denied, denied},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			policy := PolicyFunc(func(req *PolicyRequest) (*Operation, error) {
+				return nil, tc.Err
+			})
+
+			ops := []*Operation{
+				&Operation{Op: OpTest, Path: "/a", Value: 1},
+			}
+			_, err := PatchWithPolicy(map[string]interface{}{"a": 1}, ops, policy)
+
+			var perr *PatchError
+			if !errors.As(err, &perr) || !errors.Is(err, ErrDenied) {
+				t.Fatalf("bad: %#v", err)
+			}
+			if perr.Index != 0 {
+				t.Fatalf("bad: %d", perr.Index)
+			}
+			if tc.Cause != nil && perr.Cause != tc.Cause {
+				t.Fatalf("bad: %#v", perr.Cause)
+			}
+		})
+	}
+}
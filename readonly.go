@@ -0,0 +1,205 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/pointerstructure"
+)
+
+// readOnly returns a *ReadOnlyError if the operation op with the given
+// value at pointer p within doc would change a struct field with the
+// "readonly" option in its "patchstructure" tag.
+//
+// The path p can't be the read-only field or a path within it. If the
+// operation replaces the value at p, any read-only fields of a struct
+// at p, including those of nested structs, must also be unchanged by the
+// new value. A "remove" only replaces struct fields and the root since
+// other values are deleted, and an "add" doesn't replace slice elements
+// since it inserts before them. The elements of slices, arrays, and maps
+// within the value at p are checked the same way, matched to the elements
+// of the new value by index or key.
+func readOnly(op Op, p *pointerstructure.Pointer, doc, value interface{}) error {
+	current := reflect.ValueOf(doc)
+	parent := reflect.Invalid
+	for i, part := range p.Parts {
+		current = indirect(current, false)
+		if current.Kind() == reflect.Ptr && current.IsNil() {
+			// A nil pointer to a struct is allocated when it is set into
+			// so its fields are checked as if it were the zero value.
+			current = reflect.Zero(current.Type().Elem())
+		}
+
+		// If the path doesn't exist then there is nothing to replace and
+		// the operation fails on its own or adds a new value.
+		parent = current.Kind()
+		switch parent {
+		case reflect.Map:
+			key, err := mapKey(part, current.Type().Key())
+			if err != nil {
+				return nil
+			}
+
+			current = current.MapIndex(key)
+
+		case reflect.Slice, reflect.Array:
+			idx, err := sliceIndex(part, current.Len())
+			if err != nil {
+				return nil
+			}
+
+			current = current.Index(idx)
+
+		case reflect.Struct:
+			t := current.Type()
+			idx := -1
+			for j := 0; j < t.NumField(); j++ {
+				if n, ok := structFieldName(t.Field(j)); ok && n == part {
+					idx = j
+					break
+				}
+			}
+			if idx < 0 {
+				return nil
+			}
+			if structFieldOption(t.Field(idx), "readonly") {
+				return &ReadOnlyError{
+					Path: (&pointerstructure.Pointer{Parts: p.Parts[:i+1]}).String(),
+				}
+			}
+
+			current = current.Field(idx)
+
+		default:
+			return nil
+		}
+	}
+
+	switch op {
+	case OpReplace:
+	case OpAdd:
+		if parent == reflect.Slice {
+			return nil
+		}
+	case OpRemove:
+		if parent != reflect.Invalid && parent != reflect.Struct {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	return readOnlyValue(p.Parts, current, reflect.ValueOf(value))
+}
+
+// readOnlyValue returns a *ReadOnlyError if replacing the value current at
+// the path parts with value would change a read-only field of current. The
+// value is coerced the same way it is when it is set so, for example, a
+// map setting the field to an equal number is allowed.
+func readOnlyValue(parts []string, current, value reflect.Value) error {
+	current = indirect(current, false)
+	value = testIndirect(value)
+	switch current.Kind() {
+	case reflect.Struct:
+		return readOnlyStruct(parts, current, value)
+
+	case reflect.Slice, reflect.Array:
+		// Elements that the new value doesn't have are deleted rather
+		// than changed, so only the elements in both are checked.
+		if !testIsArray(value.Kind()) {
+			return nil
+		}
+
+		for i := 0; i < current.Len() && i < value.Len(); i++ {
+			elemParts := append(append([]string{}, parts...), fmt.Sprint(i))
+			if err := readOnlyValue(elemParts, current.Index(i), value.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if value.Kind() != reflect.Map {
+			return nil
+		}
+
+		members := testMembers(value)
+		for _, k := range current.MapKeys() {
+			name := fmt.Sprint(k.Interface())
+			member, ok := members[name]
+			if !ok {
+				continue
+			}
+
+			elemParts := append(append([]string{}, parts...), name)
+			if err := readOnlyValue(elemParts, current.MapIndex(k), member); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readOnlyStruct returns a *ReadOnlyError if replacing the struct current
+// at the path parts with value would change one of its read-only fields.
+func readOnlyStruct(parts []string, current, value reflect.Value) error {
+	t := current.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := structFieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+
+		field := current.Field(i)
+		member := readOnlyMember(value, name)
+		fieldParts := append(append([]string{}, parts...), name)
+		if !structFieldOption(t.Field(i), "readonly") {
+			if err := readOnlyValue(fieldParts, field, member); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// A missing or null member sets the field to its zero value
+		changed := !field.IsZero()
+		if testIndirect(member).IsValid() {
+			elem, err := coerceValue(member, field.Type(), false)
+			changed = err != nil || !reflect.DeepEqual(elem.Interface(), field.Interface())
+		}
+		if changed {
+			return &ReadOnlyError{
+				Path: (&pointerstructure.Pointer{Parts: fieldParts}).String(),
+			}
+		}
+	}
+
+	return nil
+}
+
+// readOnlyMember returns the member of the object value that sets the
+// struct field name, matching keys like coerceStruct. This returns the
+// invalid value if there is no such member.
+func readOnlyMember(value reflect.Value, name string) reflect.Value {
+	switch value.Kind() {
+	case reflect.Struct:
+		return testMembers(value)[name]
+
+	case reflect.Map:
+		var result reflect.Value
+		for k, v := range testMembers(value) {
+			if k == name {
+				return v
+			}
+			if strings.EqualFold(k, name) {
+				result = v
+			}
+		}
+
+		return result
+
+	default:
+		return reflect.Value{}
+	}
+}
@@ -0,0 +1,361 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	type testMeta struct {
+		Version int `patchstructure:"version,readonly"`
+		Note    string
+	}
+
+	type testItem struct {
+		ID   int `patchstructure:"id,readonly"`
+		Name string
+	}
+
+	type testStruct struct {
+		ID    int                 `json:"id" patchstructure:",readonly"`
+		Name  string              `json:"name"`
+		Meta  testMeta            `patchstructure:"meta"`
+		Items []testItem          `patchstructure:"items"`
+		Tags  []string            `patchstructure:"tags,readonly"`
+		Alias []string            `patchstructure:"alias"`
+		Extra map[string]string   `patchstructure:"extra"`
+		ByID  map[string]testItem `patchstructure:"byid"`
+	}
+
+	input := func() *testStruct {
+		return &testStruct{
+			ID:    1,
+			Name:  "foo",
+			Meta:  testMeta{Version: 2},
+			Items: []testItem{{ID: 3, Name: "a"}},
+			Tags:  []string{"x"},
+			ByID:  map[string]testItem{"a": {ID: 5, Name: "a"}},
+		}
+	}
+
+	cases := []struct {
+		Name     string
+		Op       *Operation
+		Expected interface{}
+		Path     string // Path of the read-only error, if any
+	}{
+		{
+			"replace field",
+			&Operation{Op: OpReplace, Path: "/id", Value: 2},
+			nil,
+			"/id",
+		},
+
+		{
+			"add field",
+			&Operation{Op: OpAdd, Path: "/id", Value: 1},
+			nil,
+			"/id",
+		},
+
+		{
+			"remove field",
+			&Operation{Op: OpRemove, Path: "/id"},
+			nil,
+			"/id",
+		},
+
+		{
+			"increment field",
+			&Operation{Op: OpIncrement, Path: "/id", Value: 1},
+			nil,
+			"/id",
+		},
+
+		{
+			"move from field",
+			&Operation{Op: OpMove, From: "/tags", Path: "/extra"},
+			nil,
+			"/tags",
+		},
+
+		{
+			"move to field",
+			&Operation{Op: OpMove, From: "/name", Path: "/meta/version"},
+			nil,
+			"/meta/version",
+		},
+
+		{
+			"copy to field",
+			&Operation{Op: OpCopy, From: "/items/0/id", Path: "/id"},
+			nil,
+			"/id",
+		},
+
+		{
+			"within field",
+			&Operation{Op: OpAdd, Path: "/tags/-", Value: "y"},
+			nil,
+			"/tags",
+		},
+
+		{
+			"nested field",
+			&Operation{Op: OpReplace, Path: "/items/0/id", Value: 4},
+			nil,
+			"/items/0/id",
+		},
+
+		{
+			"copy from field",
+			&Operation{Op: OpCopy, From: "/tags", Path: "/alias"},
+			func() interface{} {
+				v := input()
+				v.Alias = []string{"x"}
+				return v
+			}(),
+			"",
+		},
+
+		{
+			"test field",
+			&Operation{Op: OpTest, Path: "/id", Value: 1},
+			input(),
+			"",
+		},
+
+		{
+			"replace other field",
+			&Operation{Op: OpReplace, Path: "/name", Value: "bar"},
+			func() interface{} {
+				v := input()
+				v.Name = "bar"
+				return v
+			}(),
+			"",
+		},
+
+		{
+			"replace parent unchanged",
+			&Operation{
+				Op:    OpReplace,
+				Path:  "/meta",
+				Value: map[string]interface{}{"version": float64(2), "Note": "n"},
+			},
+			func() interface{} {
+				v := input()
+				v.Meta.Note = "n"
+				return v
+			}(),
+			"",
+		},
+
+		{
+			"replace parent changed",
+			&Operation{
+				Op:    OpReplace,
+				Path:  "/meta",
+				Value: map[string]interface{}{"version": float64(3)},
+			},
+			nil,
+			"/meta/version",
+		},
+
+		{
+			"replace parent missing field",
+			&Operation{
+				Op:    OpReplace,
+				Path:  "/meta",
+				Value: map[string]interface{}{"Note": "n"},
+			},
+			nil,
+			"/meta/version",
+		},
+
+		{
+			"replace root changed",
+			&Operation{
+				Op:    OpReplace,
+				Path:  "",
+				Value: &testStruct{ID: 2},
+			},
+			nil,
+			"/id",
+		},
+
+		{
+			"remove parent",
+			&Operation{Op: OpRemove, Path: "/meta"},
+			nil,
+			"/meta/version",
+		},
+
+		{
+			"replace slice element changed",
+			&Operation{
+				Op:    OpReplace,
+				Path:  "/items/0",
+				Value: map[string]interface{}{"id": float64(4)},
+			},
+			nil,
+			"/items/0/id",
+		},
+
+		{
+			"replace slice changes element field",
+			&Operation{
+				Op:    OpReplace,
+				Path:  "/items",
+				Value: []interface{}{map[string]interface{}{"id": float64(999)}},
+			},
+			nil,
+			"/items/0/id",
+		},
+
+		{
+			"replace slice keeps element fields",
+			&Operation{
+				Op:   OpReplace,
+				Path: "/items",
+				Value: []interface{}{
+					map[string]interface{}{"id": float64(3), "Name": "b"},
+					map[string]interface{}{"id": float64(7)},
+				},
+			},
+			func() interface{} {
+				v := input()
+				v.Items = []testItem{{ID: 3, Name: "b"}, {ID: 7}}
+				return v
+			}(),
+			"",
+		},
+
+		{
+			"replace slice removes element",
+			&Operation{Op: OpReplace, Path: "/items", Value: []interface{}{}},
+			func() interface{} {
+				v := input()
+				v.Items = []testItem{}
+				return v
+			}(),
+			"",
+		},
+
+		{
+			"replace map changes element field",
+			&Operation{
+				Op:   OpReplace,
+				Path: "/byid",
+				Value: map[string]interface{}{
+					"a": map[string]interface{}{"id": float64(42)},
+				},
+			},
+			nil,
+			"/byid/a/id",
+		},
+
+		{
+			"replace root changes map element field",
+			&Operation{
+				Op:   OpReplace,
+				Path: "",
+				Value: &testStruct{
+					ID:   1,
+					Meta: testMeta{Version: 2},
+					Tags: []string{"x"},
+					ByID: map[string]testItem{"a": {ID: 6}},
+				},
+			},
+			nil,
+			"/byid/a/id",
+		},
+
+		{
+			"replace map adds element",
+			&Operation{
+				Op:   OpReplace,
+				Path: "/byid",
+				Value: map[string]interface{}{
+					"b": map[string]interface{}{"id": float64(42)},
+				},
+			},
+			func() interface{} {
+				v := input()
+				v.ByID = map[string]testItem{"b": {ID: 42}}
+				return v
+			}(),
+			"",
+		},
+
+		{
+			"add slice element",
+			&Operation{
+				Op:    OpAdd,
+				Path:  "/items/0",
+				Value: map[string]interface{}{"id": float64(4)},
+			},
+			func() interface{} {
+				v := input()
+				v.Items = append([]testItem{{ID: 4}}, v.Items...)
+				return v
+			}(),
+			"",
+		},
+
+		{
+			"remove slice element",
+			&Operation{Op: OpRemove, Path: "/items/0"},
+			func() interface{} {
+				v := input()
+				v.Items = []testItem{}
+				return v
+			}(),
+			"",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			actual, err := tc.Op.Apply(input())
+			if tc.Path != "" {
+				var roErr *ReadOnlyError
+				if !errors.As(err, &roErr) || !errors.Is(err, ErrReadOnly) {
+					t.Fatalf("bad: %#v", err)
+				}
+				if roErr.Path != tc.Path {
+					t.Fatalf("bad: %s", roErr.Path)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v\n\nexpected: %#v", actual, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestReadOnly_moveUnmodified(t *testing.T) {
+	type testStruct struct {
+		Name string
+		ID   int `patchstructure:",readonly"`
+	}
+
+	v := &testStruct{Name: "foo", ID: 1}
+	op := &Operation{Op: OpMove, From: "/Name", Path: "/ID"}
+	if _, err := op.Apply(v); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("bad: %s", err)
+	}
+
+	expected := &testStruct{Name: "foo", ID: 1}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("bad: %#v", v)
+	}
+}
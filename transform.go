@@ -0,0 +1,527 @@
+package patchstructure
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Transform transforms the patches a and b, which were both created
+// against the same value, so that each can be applied after the other.
+// The result a' applies a to the value after b and b' applies b to the
+// value after a. Applying a then b' or b then a' results in the same
+// value. This is the operational transformation used to merge concurrent
+// edits to a value.
+//
+// Slice indices are shifted to account for values added and removed
+// by the other patch. When both patches insert at the same index, the
+// value from a comes first. Paths within a value that the other patch
+// moved are updated to the new location, and operations whose target was
+// removed by the other patch are dropped. Identical changes are only
+// applied once.
+//
+// Changes that can't both be kept, such as replacing the same value
+// differently, changing a value within a value that the other patch
+// replaced, or a test whose value the other patch changed, are a conflict
+// and an error wrapping ErrConflict is returned. Concurrent appends to
+// the same slice with "-" are also a conflict since the order can't be
+// determined without the value; use indices for these.
+//
+// Since Transform doesn't have the value, path elements that are
+// integers are treated as slice indices. Patches that use integer map keys
+// may be transformed incorrectly. Custom operations registered with
+// RegisterOp are treated as replacing the value at their path. Operations
+// with Glob set can't be transformed and are an error wrapping
+// ErrInvalidPath.
+func Transform(a, b []*Operation) ([]*Operation, []*Operation, error) {
+	as, err := otOps(a, "a")
+	if err != nil {
+		return nil, nil, err
+	}
+	bs, err := otOps(b, "b")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Each operation in b is transformed through every operation in a,
+	// and every operation in a is transformed through it in turn.
+	var bResult []*otOp
+	for _, y := range bs {
+		var next []*otOp
+		for _, x := range as {
+			if y != nil {
+				var err error
+				x, y, err = otTransform(x, y)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+
+			if x != nil {
+				next = append(next, x)
+			}
+		}
+
+		as = next
+		if y != nil {
+			bResult = append(bResult, y)
+		}
+	}
+
+	return otOperations(as), otOperations(bResult), nil
+}
+
+// otKind is the kind of change that an operation makes at one of its paths.
+type otKind int
+
+const (
+	otRead      otKind = iota // reads the value, such as test
+	otReplace                 // replaces an existing value
+	otIncrement               // increments an existing number
+	otDelete                  // removes an existing value
+	otSet                     // sets a value that may not exist, such as a map key
+	otInsert                  // inserts a value into a slice
+)
+
+// otOp is an operation being transformed. The paths of the operation are
+// split into prims in the order they are applied: the from path of a
+// move or copy comes before the path.
+type otOp struct {
+	op    *Operation
+	index int
+	patch string
+	prims []otPrim
+}
+
+// otPrim is a single path of an operation being transformed.
+type otPrim struct {
+	kind otKind
+	path []string
+
+	// owner is the operation that this path belongs to.
+	owner *otOp
+
+	// removed is set when the path was removed by the other operation.
+	removed bool
+
+	// reloc is the remainder of the path after the from path of a move
+	// by relocBy. The path is updated when the path of the move is reached.
+	reloc   []string
+	relocBy *otOp
+
+	// conflict is set if the path can't be transformed.
+	conflict bool
+}
+
+// dest returns true if the path is a destination that need not exist.
+func (p *otPrim) dest() bool {
+	return p.kind == otSet || p.kind == otInsert
+}
+
+// otOps parses the paths of the operations in the patch named name.
+func otOps(ops []*Operation, name string) ([]*otOp, error) {
+	result := make([]*otOp, len(ops))
+	for i, op := range ops {
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d of %s: %w", i, name, err)
+		}
+		if op.Glob {
+			return nil, fmt.Errorf(
+				"operation %d of %s: %w: glob paths can't be transformed",
+				i, name, ErrInvalidPath)
+		}
+
+		o := &otOp{op: op, index: i, patch: name}
+		switch op.Op {
+		case OpMove, OpCopy:
+			from, err := parsePointer(op.From)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d of %s: %w", i, name, err)
+			}
+
+			kind := otRead
+			if op.Op == OpMove {
+				kind = otDelete
+			}
+
+			o.prims = []otPrim{
+				{kind: kind, path: from.Parts},
+				{kind: otDestKind(path.Parts), path: path.Parts},
+			}
+
+		case OpAdd:
+			o.prims = []otPrim{{kind: otDestKind(path.Parts), path: path.Parts}}
+
+		case OpRemove:
+			o.prims = []otPrim{{kind: otDelete, path: path.Parts}}
+
+		case OpTest:
+			o.prims = []otPrim{{kind: otRead, path: path.Parts}}
+
+		case OpIncrement:
+			o.prims = []otPrim{{kind: otIncrement, path: path.Parts}}
+
+		default:
+			o.prims = []otPrim{{kind: otReplace, path: path.Parts}}
+		}
+
+		result[i] = o
+	}
+
+	return result, nil
+}
+
+// otOperations turns the transformed operations back into operations.
+func otOperations(ops []*otOp) []*Operation {
+	result := make([]*Operation, len(ops))
+	for i, o := range ops {
+		op := *o.op
+		op.Path = diffPath(o.prims[len(o.prims)-1].path)
+		if len(o.prims) > 1 {
+			op.From = diffPath(o.prims[0].path)
+		}
+
+		result[i] = &op
+	}
+
+	return result
+}
+
+// otTransform transforms the operations x and y, which apply to the same
+// value, so that x applies after y and y applies after x. x is from patch a
+// so it comes first for inserts at the same index. Either result is nil
+// if the operation is dropped.
+func otTransform(x, y *otOp) (*otOp, *otOp, error) {
+	// Identical changes only need to be applied once
+	if otIdempotent(x) && otEqual(x, y) {
+		return nil, nil, nil
+	}
+
+	if otConflict(x, y) {
+		return nil, nil, otConflictError(x, y)
+	}
+
+	xt, yt := otCopy(x), otCopy(y)
+	for j := range yt.prims {
+		for i := range xt.prims {
+			xt.prims[i], yt.prims[j] =
+				otShift(xt.prims[i], yt.prims[j], true),
+				otShift(yt.prims[j], xt.prims[i], false)
+		}
+	}
+
+	xt, xerr := otResult(xt)
+	yt, yerr := otResult(yt)
+	if xerr != nil || yerr != nil {
+		return nil, nil, otConflictError(x, y)
+	}
+
+	return xt, yt, nil
+}
+
+// otConflict returns true if the changes made by the operations x and y
+// can't both be kept.
+func otConflict(x, y *otOp) bool {
+	xs, ys := otBasePaths(x), otBasePaths(y)
+	for _, a := range xs {
+		for _, b := range ys {
+			if otPrimConflict(a, b) || otPrimConflict(b, a) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// otPrimConflict returns true if the change at a is lost or changed by
+// the change at b.
+func otPrimConflict(a, b otPrim) bool {
+	switch b.kind {
+	case otRead:
+		return false
+
+	case otInsert:
+		parent := b.path[:len(b.path)-1]
+		switch a.kind {
+		case otRead:
+			// Inserting changes the slice, but not the elements
+			return otPrefix(a.path, parent)
+
+		case otInsert:
+			// Appends to the same slice can't be ordered
+			return otEqualPath(a.path, b.path) && b.path[len(b.path)-1] == "-"
+		}
+
+		return false
+	}
+
+	// b changes the value at its path
+	if a.kind == otRead {
+		return otPrefix(a.path, b.path) || otPrefix(b.path, a.path)
+	}
+	if !otPrefix(b.path, a.path) {
+		return false
+	}
+
+	// If a is within the value changed by b then a is lost, unless b
+	// removed it which drops or moves a.
+	if len(a.path) > len(b.path) {
+		return b.kind != otDelete
+	}
+
+	switch {
+	case a.kind == otInsert:
+		// a inserts before the value at b so they're unrelated
+		return false
+
+	case b.kind == otDelete:
+		// Values that are replaced or incremented are dropped, but
+		// setting a value that was removed or removing it twice differs
+		// depending on the order.
+		return a.kind == otDelete || a.kind == otSet
+
+	case b.kind == otIncrement:
+		return a.kind != otIncrement && a.kind != otDelete
+
+	default:
+		// Values that are removed after being replaced are dropped
+		return a.kind != otDelete || b.kind == otSet
+	}
+}
+
+// otBasePaths returns the paths of the operation relative to the value
+// before it is applied. The path of a move is relative to the value after
+// the from path is removed, so it is shifted back.
+func otBasePaths(o *otOp) []otPrim {
+	if o.op.Op != OpMove {
+		return o.prims
+	}
+
+	from, path := o.prims[0], o.prims[1]
+	path.path = otShiftIndex(path.path, from.path, func(j, k int) int {
+		if j >= k {
+			return j + 1
+		}
+
+		return j
+	})
+
+	return []otPrim{from, path}
+}
+
+// otIdempotent returns true if applying the operation twice has the same
+// result as applying it once, with the second one removed.
+func otIdempotent(o *otOp) bool {
+	switch o.op.Op {
+	case OpRemove, OpReplace, OpMove:
+		return true
+
+	case OpAdd, OpCopy:
+		return o.prims[len(o.prims)-1].kind == otSet
+	}
+
+	return false
+}
+
+// otEqual returns true if the operations make the same change.
+func otEqual(x, y *otOp) bool {
+	if x.op.Op != y.op.Op || len(x.prims) != len(y.prims) {
+		return false
+	}
+
+	for i := range x.prims {
+		if !otEqualPath(x.prims[i].path, y.prims[i].path) {
+			return false
+		}
+	}
+
+	return reflect.DeepEqual(x.op.Value, y.op.Value)
+}
+
+// otCopy copies the operation so its paths can be transformed.
+func otCopy(o *otOp) *otOp {
+	result := &otOp{op: o.op, index: o.index, patch: o.patch}
+	result.prims = make([]otPrim, len(o.prims))
+	for i, p := range o.prims {
+		result.prims[i] = otPrim{kind: p.kind, path: p.path, owner: result}
+	}
+
+	return result
+}
+
+// otShift transforms the path p so that it applies after the path q. If
+// both insert at the same index, p comes first if first is true.
+func otShift(p, q otPrim, first bool) otPrim {
+	if p.removed || p.conflict || q.removed || q.conflict || q.reloc != nil {
+		return p
+	}
+
+	// A path within the from path of a move is relocated to the path of
+	// the move, which is always the next path of that operation.
+	if p.reloc != nil {
+		if q.owner == p.relocBy && q.dest() {
+			if q.path[len(q.path)-1] == "-" {
+				p.conflict = true
+			} else {
+				p.path = append(append([]string(nil), q.path...), p.reloc...)
+			}
+
+			p.reloc = nil
+			p.relocBy = nil
+		}
+
+		return p
+	}
+
+	switch q.kind {
+	case otDelete:
+		if otPrefix(q.path, p.path) && !(p.dest() && len(p.path) == len(q.path)) {
+			if q.owner.op.Op == OpMove {
+				p.reloc = append([]string{}, p.path[len(q.path):]...)
+				p.relocBy = q.owner
+			} else {
+				p.removed = true
+			}
+
+			return p
+		}
+
+		p.path = otShiftIndex(p.path, q.path, func(j, k int) int {
+			if j > k {
+				return j - 1
+			}
+
+			return j
+		})
+
+	case otInsert:
+		p.path = otShiftIndex(p.path, q.path, func(j, k int) int {
+			if j > k {
+				return j + 1
+			}
+
+			// Inserting at the same index only keeps its place if it
+			// comes first.
+			if j == k && !(first && p.kind == otInsert && len(p.path) == len(q.path)) {
+				return j + 1
+			}
+
+			return j
+		})
+	}
+
+	return p
+}
+
+// otShiftIndex returns the path p with the index within the slice
+// containing q replaced by fn(j, k), where j is the index in p and k is
+// the index in q. The path is returned unchanged if it isn't within the
+// same slice as q.
+func otShiftIndex(p, q []string, fn func(j, k int) int) []string {
+	if len(q) == 0 || len(p) < len(q) {
+		return p
+	}
+
+	parent := q[:len(q)-1]
+	if !otPrefix(parent, p) {
+		return p
+	}
+
+	k, ok := otIndex(q[len(parent)])
+	if !ok {
+		return p
+	}
+	j, ok := otIndex(p[len(parent)])
+	if !ok {
+		return p
+	}
+
+	n := fn(j, k)
+	if n == j {
+		return p
+	}
+
+	result := make([]string, len(p))
+	copy(result, p)
+	result[len(parent)] = strconv.Itoa(n)
+	return result
+}
+
+// otResult returns the transformed operation, or nil if it should be
+// dropped because its target was removed. An error is returned if it
+// can't be transformed.
+func otResult(o *otOp) (*otOp, error) {
+	var removed bool
+	for i, p := range o.prims {
+		if p.conflict || p.reloc != nil {
+			return o, ErrConflict
+		}
+		if !p.removed {
+			continue
+		}
+
+		// A move would lose the value it moved and a copy would lose
+		// the value it copied if we dropped them.
+		if o.op.Op == OpMove || (o.op.Op == OpCopy && i == 0) {
+			return o, ErrConflict
+		}
+
+		removed = true
+	}
+
+	if removed {
+		return nil, nil
+	}
+
+	return o, nil
+}
+
+// otConflictError returns the error for a conflict between x and y.
+func otConflictError(x, y *otOp) error {
+	return fmt.Errorf(
+		"%w: operation %d of %s (%s %q) and operation %d of %s (%s %q)",
+		ErrConflict,
+		x.index, x.patch, x.op.Op, x.op.Path,
+		y.index, y.patch, y.op.Op, y.op.Path)
+}
+
+// otIndex parses a slice index. "-" and other values that aren't indices
+// return false.
+func otIndex(part string) (int, bool) {
+	idx, err := parseIndex(part)
+	return idx, err == nil
+}
+
+// otPrefix returns true if the path prefix is equal to or a parent of p.
+func otPrefix(prefix, p []string) bool {
+	return len(prefix) <= len(p) && otEqualPath(prefix, p[:len(prefix)])
+}
+
+// otEqualPath returns true if the paths are equal.
+func otEqualPath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// otDestKind returns the kind of change for adding a value at p.
+func otDestKind(p []string) otKind {
+	if len(p) > 0 {
+		last := p[len(p)-1]
+		if _, ok := otIndex(last); ok || last == "-" {
+			return otInsert
+		}
+	}
+
+	return otSet
+}
@@ -0,0 +1,450 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/copystructure"
+)
+
+func TestTransform(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Input    interface{}
+		A        []*Operation
+		B        []*Operation
+		Expected interface{}
+		Err      bool
+	}{
+		{
+			"independent keys",
+			map[string]interface{}{"a": 1, "b": 2},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 10},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/b"},
+				&Operation{Op: OpAdd, Path: "/c", Value: 3},
+			},
+			map[string]interface{}{"a": 10, "c": 3},
+			false,
+		},
+
+		{
+			"insert different indices",
+			[]interface{}{"a", "b", "c"},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/0", Value: "x"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/2", Value: "y"},
+			},
+			[]interface{}{"x", "a", "b", "y", "c"},
+			false,
+		},
+
+		{
+			"insert same index",
+			[]interface{}{"a", "b"},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/1", Value: "x"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/1", Value: "y"},
+			},
+			[]interface{}{"a", "x", "y", "b"},
+			false,
+		},
+
+		{
+			"insert and append",
+			[]interface{}{"a", "b"},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/1", Value: "x"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/-", Value: "y"},
+			},
+			[]interface{}{"a", "x", "b", "y"},
+			false,
+		},
+
+		{
+			"remove and insert",
+			[]interface{}{"a", "b", "c"},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/0"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/2", Value: "x"},
+			},
+			[]interface{}{"b", "x", "c"},
+			false,
+		},
+
+		{
+			"remove and replace shifted",
+			[]interface{}{"a", "b", "c"},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/1"},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/2", Value: "x"},
+			},
+			[]interface{}{"a", "x"},
+			false,
+		},
+
+		{
+			"replace removed value",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			map[string]interface{}{},
+			false,
+		},
+
+		{
+			"change within removed value",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a/c", Value: 2},
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 3},
+			},
+			map[string]interface{}{},
+			false,
+		},
+
+		{
+			"same remove",
+			[]interface{}{"a", "b", "c"},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/1"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/1"},
+			},
+			[]interface{}{"a", "c"},
+			false,
+		},
+
+		{
+			"same replace",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+			},
+			map[string]interface{}{"a": 2},
+			false,
+		},
+
+		{
+			"increment twice",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpIncrement, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpIncrement, Path: "/a", Value: 3},
+			},
+			map[string]interface{}{"a": 6},
+			false,
+		},
+
+		{
+			"change within moved value",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a", Path: "/c"},
+			},
+			map[string]interface{}{
+				"c": map[string]interface{}{"b": 2},
+			},
+			false,
+		},
+
+		{
+			"change within moved slice element",
+			[]interface{}{
+				"a",
+				map[string]interface{}{"b": 1},
+				"c",
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/1", Path: "/0"},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/1/b", Value: 2},
+				&Operation{Op: OpReplace, Path: "/2", Value: "x"},
+			},
+			[]interface{}{
+				map[string]interface{}{"b": 2},
+				"a",
+				"x",
+			},
+			false,
+		},
+
+		{
+			"move and insert",
+			[]interface{}{"a", "b", "c", "d"},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/0", Path: "/2"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/2", Value: "x"},
+			},
+			[]interface{}{"b", "x", "c", "a", "d"},
+			false,
+		},
+
+		{
+			"move both",
+			[]interface{}{"a", "b", "c", "d", "e"},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/0", Path: "/2"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/3", Path: "/0"},
+			},
+			[]interface{}{"d", "b", "c", "a", "e"},
+			false,
+		},
+
+		{
+			"multiple operations",
+			[]interface{}{"a", "b", "c"},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/0", Value: "x"},
+				&Operation{Op: OpRemove, Path: "/3"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/1"},
+				&Operation{Op: OpAdd, Path: "/-", Value: "y"},
+			},
+			[]interface{}{"x", "a", "y"},
+			false,
+		},
+
+		{
+			"test unrelated",
+			map[string]interface{}{"a": 1, "b": 2},
+			[]*Operation{
+				&Operation{Op: OpTest, Path: "/a", Value: 1},
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/b", Value: 4},
+			},
+			map[string]interface{}{"a": 3, "b": 4},
+			false,
+		},
+
+		{
+			"replace same path",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"change within replaced value",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a/b", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: 3},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"insert into replaced slice",
+			map[string]interface{}{"a": []interface{}{1}},
+			[]*Operation{
+				&Operation{Op: OpReplace, Path: "/a", Value: []interface{}{}},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a/0", Value: 2},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"test changed value",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpTest, Path: "/a", Value: 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpIncrement, Path: "/a", Value: 1},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"test inserted slice",
+			map[string]interface{}{"a": []interface{}{1}},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a/0", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpTest, Path: "/a", Value: []interface{}{1}},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"append both",
+			[]interface{}{"a"},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/-", Value: "x"},
+			},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/-", Value: "y"},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"add and remove key",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: 2},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"remove and move",
+			map[string]interface{}{"a": 1},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a", Path: "/b"},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"move from removed value",
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": 1},
+			},
+			[]*Operation{
+				&Operation{Op: OpMove, From: "/a/b", Path: "/c"},
+			},
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+			},
+			nil,
+			true,
+		},
+
+		{
+			"invalid path",
+			map[string]interface{}{},
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "a", Value: 1},
+			},
+			nil,
+			nil,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			a, b, err := Transform(tc.A, tc.B)
+			if (err != nil) != tc.Err {
+				t.Fatalf("err: %s", err)
+			}
+			if err != nil {
+				return
+			}
+
+			// Applying either patch first must give the same result
+			left := testTransformApply(t, tc.Input, tc.A, b)
+			right := testTransformApply(t, tc.Input, tc.B, a)
+			if !reflect.DeepEqual(left, tc.Expected) {
+				t.Fatalf("bad a then b': %#v", left)
+			}
+			if !reflect.DeepEqual(right, tc.Expected) {
+				t.Fatalf("bad b then a': %#v", right)
+			}
+		})
+	}
+}
+
+func TestTransform_conflictError(t *testing.T) {
+	_, _, err := Transform(
+		[]*Operation{&Operation{Op: OpReplace, Path: "/a", Value: 2}},
+		[]*Operation{&Operation{Op: OpRemove, Path: "/b"}, &Operation{Op: OpAdd, Path: "/a", Value: 3}},
+	)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := `conflict: operation 0 of a (replace "/a") and operation 1 of b (add "/a")`
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func testTransformApply(t *testing.T, v interface{}, first, second []*Operation) interface{} {
+	v, err := copystructure.Copy(v)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	v, err = Patch(v, first)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	v, err = Patch(v, second)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return v
+}
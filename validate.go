@@ -0,0 +1,46 @@
+package patchstructure
+
+// Validate checks that the operations ops would apply to the value v
+// without modifying v.
+//
+// The operations are applied in order to a deep copy of v so that each
+// operation is validated against the result of the operations before it.
+// Unlike Patch, Validate doesn't stop at the first failure: an operation
+// that fails is skipped and validation continues with the next operation.
+// If any operations fail, the error is a *ValidateError with every failure.
+func Validate(v interface{}, ops []*Operation) error {
+	current, err := copyValue(v)
+	if err != nil {
+		return err
+	}
+
+	var valid []*Operation
+	var errs []*PatchError
+	for i, op := range ops {
+		next, err := op.Apply(current)
+		if err == nil {
+			current = next
+			valid = append(valid, op)
+			continue
+		}
+
+		perr := err.(*PatchError)
+		perr.Index = i
+		errs = append(errs, perr)
+
+		// A failed operation may have partially modified the value so we
+		// rebuild it from the operations that succeeded.
+		if current, err = copyValue(v); err != nil {
+			return err
+		}
+		if current, err = Patch(current, valid); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidateError{Errors: errs}
+	}
+
+	return nil
+}
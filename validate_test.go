@@ -0,0 +1,150 @@
+package patchstructure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Ops   []*Operation
+		Input func() interface{}
+		Index []int
+	}{
+		{
+			"valid",
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: "A"},
+				&Operation{Op: OpRemove, Path: "/b"},
+			},
+			func() interface{} {
+				return map[string]interface{}{"b": 42}
+			},
+			nil,
+		},
+
+		{
+			"depends on earlier operations",
+			[]*Operation{
+				&Operation{Op: OpAdd, Path: "/a", Value: []interface{}{}},
+				&Operation{Op: OpAdd, Path: "/a/1", Value: 1},
+				&Operation{Op: OpRemove, Path: "/b"},
+				&Operation{Op: OpAdd, Path: "/b", Value: 2},
+				&Operation{Op: OpTest, Path: "/b", Value: 2},
+			},
+			func() interface{} {
+				return map[string]interface{}{"b": 42}
+			},
+			[]int{1},
+		},
+
+		{
+			"every failure",
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/nope"},
+				&Operation{Op: OpAdd, Path: "invalid", Value: 42},
+				&Operation{Op: OpReplace, Path: "/a/5", Value: 42},
+				&Operation{Op: OpMove, Path: "/a/0/b", From: "/a/0"},
+				&Operation{Op: OpReplace, Path: "/b", Value: "foo"},
+				&Operation{Op: OpAdd, Path: "/c", Value: 12},
+				&Operation{Op: OpTest, Path: "/c", Value: 12},
+			},
+			func() interface{} {
+				return &struct {
+					A []interface{} `json:"a"`
+					B int           `json:"b"`
+					C int           `json:"c"`
+				}{}
+			},
+			[]int{0, 1, 2, 3, 4},
+		},
+
+		{
+			"failed operation is skipped",
+			[]*Operation{
+				&Operation{Op: OpRemove, Path: "/a"},
+				&Operation{Op: OpMove, Path: "/c/d", From: "/a"},
+				&Operation{Op: OpTest, Path: "/a", Value: 1},
+			},
+			func() interface{} {
+				return map[string]interface{}{"a": 1}
+			},
+			[]int{1, 2},
+		},
+
+		{
+			"null value",
+			[]*Operation{
+				&Operation{Op: OpTest, Path: "", Value: nil},
+				&Operation{Op: OpRemove, Path: "/a"},
+				&Operation{Op: OpAdd, Path: "", Value: map[string]interface{}{}},
+			},
+			func() interface{} {
+				return nil
+			},
+			[]int{1},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d-%s", i, tc.Name), func(t *testing.T) {
+			input := tc.Input()
+			err := Validate(input, tc.Ops)
+			if (err != nil) != (len(tc.Index) > 0) {
+				t.Fatalf("err: %s", err)
+			}
+
+			// The input must never be modified
+			if !reflect.DeepEqual(input, tc.Input()) {
+				t.Fatalf("input modified: %#v", input)
+			}
+
+			if err == nil {
+				return
+			}
+
+			var verr *ValidateError
+			if !errors.As(err, &verr) {
+				t.Fatalf("not a ValidateError: %#v", err)
+			}
+
+			var actual []int
+			for _, perr := range verr.Errors {
+				actual = append(actual, perr.Index)
+			}
+			if !reflect.DeepEqual(actual, tc.Index) {
+				t.Fatalf("bad: %#v\n\n%s", actual, err)
+			}
+		})
+	}
+}
+
+func TestValidate_errors(t *testing.T) {
+	err := Validate(map[string]interface{}{"a": 1}, []*Operation{
+		&Operation{Op: OpTest, Path: "/a", Value: 2},
+		&Operation{Op: OpRemove, Path: "/b"},
+	})
+
+	// Each operation that failed is checked by errors.Is
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("bad: %s", err)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bad: %s", err)
+	}
+	if errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// errors.As finds the first operation that failed
+	var perr *PatchError
+	if !errors.As(err, &perr) {
+		t.Fatalf("not a PatchError: %#v", err)
+	}
+	if perr.Index != 0 {
+		t.Fatalf("bad: %#v", perr)
+	}
+}